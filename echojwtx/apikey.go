@@ -0,0 +1,55 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// WithAPIKeyFallback accepts requests carrying an API key in the provided header as an alternative to a JWT.
+// When the header is set and validate recognizes the key, JWT validation is skipped and the returned actor is
+// set as it would be for a token with the actor as its subject. Requests without the header, or with a key which
+// isn't recognized, fall through to JWT validation. Accepted keys are audited and counted with the api_key
+// outcome and included in validation timing.
+func WithAPIKeyFallback(header string, validate func(key string) (actor string, ok bool)) Opts {
+	return func(a *Auth) {
+		a.apiKeyHeader = header
+		a.apiKeyValidator = validate
+	}
+}
+
+// apiKeyActor returns the actor for the API key provided in the request, if the key is recognized.
+func (a *Auth) apiKeyActor(c echo.Context) (string, bool) {
+	if a.apiKeyHeader == "" || a.apiKeyValidator == nil {
+		return "", false
+	}
+
+	key := c.Request().Header.Get(a.apiKeyHeader)
+	if key == "" {
+		return "", false
+	}
+
+	actor, ok := a.apiKeyValidator(key)
+	if !ok {
+		a.requestLogger(c).Debug("api key not recognized, falling back to jwt")
+
+		return "", false
+	}
+
+	a.requestLogger(c).Debug("api key accepted", zap.String("actor", actor))
+
+	return actor, true
+}
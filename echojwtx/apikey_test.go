@@ -0,0 +1,189 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestAPIKeyFallback(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	token := testHelperMustSignClaims(map[string]interface{}{
+		"iss": issuer,
+		"sub": "urn:test:user",
+	})
+
+	testCases := []struct {
+		name             string
+		apiKey           string
+		token            string
+		expectStatusCode int
+		expectActor      string
+	}{
+		{
+			"api key",
+			"s3cr3t",
+			"",
+			http.StatusOK,
+			"urn:test:machine",
+		},
+		{
+			"jwt",
+			"",
+			token,
+			http.StatusOK,
+			"urn:test:user",
+		},
+		{
+			"unrecognized api key falls back to jwt",
+			"wrong",
+			token,
+			http.StatusOK,
+			"urn:test:user",
+		},
+		{
+			"unrecognized api key without jwt",
+			"wrong",
+			"",
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"neither",
+			"",
+			"",
+			http.StatusUnauthorized,
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, echojwtx.WithAPIKeyFallback("X-API-Key", func(key string) (string, bool) {
+				if key == "s3cr3t" {
+					return "urn:test:machine", true
+				}
+
+				return "", false
+			}))
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			var actor string
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				actor = echojwtx.Actor(c)
+
+				return c.NoContent(http.StatusOK)
+			})
+
+			req := testHelperRequest(http.MethodGet, "/test", tc.token)
+
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+			assert.Equal(t, tc.expectActor, actor, "unexpected actor")
+		})
+	}
+}
+
+func TestAPIKeyFallbackObserved(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan echojwtx.AuditEvent, 1)
+	reg := prometheus.NewRegistry()
+
+	var timed bool
+
+	auth, err := echojwtx.NewAuth(ctx, echojwtx.AuthConfig{
+		Issuer: issuer,
+	},
+		echojwtx.WithAPIKeyFallback("X-API-Key", func(key string) (string, bool) {
+			return "urn:test:machine", key == "s3cr3t"
+		}),
+		echojwtx.WithAuditSink(func(_ context.Context, event echojwtx.AuditEvent) {
+			events <- event
+		}),
+		echojwtx.WithMetricsRegisterer(reg),
+		echojwtx.WithSlowValidationThreshold(0, func(_ echo.Context, _ time.Duration) {
+			timed = true
+		}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := testHelperRequest(http.MethodGet, "/test", "")
+	req.Header.Set("X-API-Key", "s3cr3t")
+
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, "expected 200 response from test server")
+
+	assert.True(t, timed, "expected api key validation to be timed")
+
+	select {
+	case event := <-events:
+		assert.Equal(t, echojwtx.AuditOutcomeAPIKey, event.Outcome, "unexpected outcome")
+		assert.Equal(t, "urn:test:machine", event.Subject, "unexpected subject")
+	case <-time.After(time.Second):
+		t.Fatal("expected audit event")
+	}
+
+	families, err := reg.Gather()
+	require.NoError(t, err, "no error expected gathering metrics")
+
+	var counted float64
+
+	for _, family := range families {
+		if family.GetName() != "echojwtx_auth_requests_total" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "outcome" && label.GetValue() == echojwtx.AuditOutcomeAPIKey {
+					counted += metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, float64(1), counted, "expected api key request to be counted")
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+)
+
+// WithAudienceProvider only accepts tokens with at least one of the audiences returned by fn, such as audiences
+// of tenants loaded from a database, so audiences may be added without restarting. This is validated in addition
+// to the configured audience. Tokens are rejected with a 401 when fn returns no audiences. fn is called for every
+// request unless WithAudienceProviderCacheDuration is set, and must be safe for concurrent use.
+func WithAudienceProvider(fn func() []string) Opts {
+	return func(a *Auth) {
+		a.audienceProvider = &audienceProvider{fetch: fn}
+	}
+}
+
+// WithAudienceProviderCacheDuration caches the audiences returned by the WithAudienceProvider function for the
+// provided duration, bounding the cost of loading them. Audiences added to the provider are accepted once the
+// cached audiences expire.
+func WithAudienceProviderCacheDuration(d time.Duration) Opts {
+	return func(a *Auth) {
+		a.audienceProviderTTL = d
+	}
+}
+
+// audienceProvider caches the audiences returned by a provider function.
+type audienceProvider struct {
+	fetch func() []string
+
+	mu        sync.Mutex
+	audiences []string
+	expires   time.Time
+}
+
+// get returns the cached audiences, fetching them if they expired.
+func (p *audienceProvider) get(now time.Time, ttl time.Duration) []string {
+	if ttl <= 0 {
+		return p.fetch()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now.Before(p.expires) {
+		return p.audiences
+	}
+
+	p.audiences = p.fetch()
+	p.expires = now.Add(ttl)
+
+	return p.audiences
+}
+
+// validateAudienceProvider validates the token has at least one of the audiences from the audience provider.
+func (a *Auth) validateAudienceProvider(c echo.Context, claims jwt.MapClaims) error {
+	if a.audienceProvider == nil {
+		return nil
+	}
+
+	allowed := a.audienceProvider.get(a.now(), a.audienceProviderTTL)
+
+	audiences, err := a.tokenAudiences(claims)
+	if err != nil {
+		a.requestLogger(c).Error("jwt user failed to get audience", zap.Error(err), zap.Any("audience", a.rawAudience(claims)))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errInvalidAudience)
+	}
+
+	for _, audience := range audiences {
+		if slices.Contains(allowed, audience) {
+			return nil
+		}
+	}
+
+	a.requestLogger(c).Error("jwt user claim audience not provided", zap.Strings("audience", audiences))
+
+	return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errInvalidAudience)
+}
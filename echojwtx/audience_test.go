@@ -0,0 +1,130 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestAudienceProvider(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	var (
+		mu        sync.Mutex
+		audiences = []string{"tenant-a"}
+		fetches   int
+		now       = time.Now()
+	)
+
+	setAudiences := func(values ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		audiences = values
+	}
+
+	provider := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		fetches++
+
+		return audiences
+	}
+
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return now
+	}
+
+	newRouter := func(opts ...echojwtx.Opts) *echo.Echo {
+		auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+			Issuer: issuer,
+		}, append([]echojwtx.Opts{echojwtx.WithAudienceProvider(provider), echojwtx.WithClock(clock)}, opts...)...)
+
+		require.NoError(t, err, "no error expected for NewAuth")
+
+		e := echo.New()
+
+		e.Use(auth.Middleware())
+
+		e.GET("/test", func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+
+		return e
+	}
+
+	doRequest := func(e *echo.Echo, audience interface{}) int {
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+			"iss": issuer,
+			"sub": "urn:test:user",
+			"aud": audience,
+		})))
+
+		return rec.Code
+	}
+
+	t.Run("uncached", func(t *testing.T) {
+		setAudiences("tenant-a")
+
+		e := newRouter()
+
+		assert.Equal(t, http.StatusOK, doRequest(e, "tenant-a"), "expected provided audience to be accepted")
+		assert.Equal(t, http.StatusOK, doRequest(e, []string{"other", "tenant-a"}), "expected one provided audience to be accepted")
+		assert.Equal(t, http.StatusUnauthorized, doRequest(e, "tenant-b"), "expected unknown audience to be rejected")
+
+		setAudiences("tenant-a", "tenant-b")
+
+		assert.Equal(t, http.StatusOK, doRequest(e, "tenant-b"), "expected added audience to be accepted")
+
+		setAudiences("tenant-b")
+
+		assert.Equal(t, http.StatusUnauthorized, doRequest(e, "tenant-a"), "expected removed audience to be rejected")
+
+		setAudiences()
+
+		assert.Equal(t, http.StatusUnauthorized, doRequest(e, "tenant-b"), "expected no provided audiences to reject all tokens")
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		setAudiences("tenant-a")
+
+		e := newRouter(echojwtx.WithAudienceProviderCacheDuration(time.Minute))
+
+		mu.Lock()
+		fetches = 0
+		mu.Unlock()
+
+		assert.Equal(t, http.StatusOK, doRequest(e, "tenant-a"), "expected provided audience to be accepted")
+
+		setAudiences("tenant-a", "tenant-b")
+
+		assert.Equal(t, http.StatusUnauthorized, doRequest(e, "tenant-b"), "expected cached audiences to be used")
+
+		mu.Lock()
+		now = now.Add(2 * time.Minute)
+		mu.Unlock()
+
+		assert.Equal(t, http.StatusOK, doRequest(e, "tenant-b"), "expected added audience after cache expires")
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		assert.Equal(t, 2, fetches, "expected audiences to be fetched once per cache duration")
+	})
+}
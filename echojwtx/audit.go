@@ -0,0 +1,245 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// auditBufferSize is the number of audit events buffered for the sink before events are dropped.
+const auditBufferSize = 1024
+
+const (
+	// AuditOutcomeSuccess is the outcome of audit events for authenticated requests.
+	AuditOutcomeSuccess = "success"
+
+	// AuditOutcomeFailure is the outcome of audit events for rejected requests.
+	AuditOutcomeFailure = "failure"
+
+	// AuditOutcomeAPIKey is the outcome of audit events for requests authenticated by WithAPIKeyFallback.
+	AuditOutcomeAPIKey = "api_key"
+)
+
+// AuditEvent describes the outcome of authenticating a request. Events never include the token.
+type AuditEvent struct {
+	// Time is the time the request was authenticated or rejected.
+	Time time.Time
+
+	// Subject is the token subject, or the API key actor, empty if the token couldn't be parsed.
+	Subject string
+
+	// Issuer is the token issuer, empty if the token couldn't be parsed.
+	Issuer string
+
+	// Outcome is one of AuditOutcomeSuccess, AuditOutcomeFailure or AuditOutcomeAPIKey.
+	Outcome string
+
+	// Reason is the ErrorReason for rejected requests, empty for authenticated requests.
+	Reason string
+
+	// Route is the matched echo route pattern.
+	Route string
+
+	// ClientIP is the client ip as reported by echo.Context#RealIP.
+	ClientIP string
+}
+
+// auditEntry is a queued audit event.
+type auditEntry struct {
+	ctx   context.Context
+	event AuditEvent
+}
+
+// detachedContext keeps the values of a request context without its cancellation so audit events may be
+// handled after the request completes.
+type detachedContext struct {
+	context.Context
+}
+
+// Deadline implements context.Context.
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+// Done implements context.Context.
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+// Err implements context.Context.
+func (detachedContext) Err() error { return nil }
+
+// WithAuditSink emits an AuditEvent to fn for every request authenticated or rejected by the middleware.
+// Requests skipped by the JWTConfig Skipper are not audited.
+//
+// Events are delivered asynchronously from a bounded buffer so a slow sink doesn't stall requests, events are
+// dropped with a warning when the buffer is full. fn is called from a single goroutine, which stops when the
+// context provided to NewAuth is canceled. The context passed to fn carries the request context values.
+func WithAuditSink(fn func(context.Context, AuditEvent)) Opts {
+	return func(a *Auth) {
+		a.auditSink = fn
+	}
+}
+
+const (
+	// cloudEventTypePrefix prefixes the outcome in the type of CloudEvents audit events.
+	cloudEventTypePrefix = "com.infratographer.echojwtx.auth."
+
+	// cloudEventIDSize is the number of random bytes in the id of CloudEvents audit events.
+	cloudEventIDSize = 16
+)
+
+// cloudEvent is the CloudEvents 1.0 json envelope of an audit event.
+type cloudEvent struct {
+	SpecVersion     string         `json:"specversion"`
+	ID              string         `json:"id"`
+	Source          string         `json:"source"`
+	Type            string         `json:"type"`
+	Subject         string         `json:"subject,omitempty"`
+	Time            time.Time      `json:"time"`
+	DataContentType string         `json:"datacontenttype"`
+	Data            cloudEventData `json:"data"`
+}
+
+// cloudEventData is the data of CloudEvents audit events.
+type cloudEventData struct {
+	Outcome  string `json:"outcome"`
+	Reason   string `json:"reason,omitempty"`
+	Issuer   string `json:"issuer,omitempty"`
+	Route    string `json:"route,omitempty"`
+	ClientIP string `json:"client_ip,omitempty"`
+}
+
+// WithCloudEventsAudit emits every audit event to fn as a CloudEvents 1.0 json event with the provided source,
+// as WithAuditSink does. A sink set with WithAuditSink still receives the events, regardless of the order the
+// options are provided in.
+//
+// The event type is com.infratographer.echojwtx.auth. followed by the outcome, success, failure or api_key, and
+// the subject is the token subject or API key actor. The data holds the outcome, reason, issuer, route and client
+// ip, no other claims and never the token are included.
+func WithCloudEventsAudit(source string, fn func(context.Context, []byte)) Opts {
+	return func(a *Auth) {
+		a.cloudEventsSource = source
+		a.cloudEventsSink = fn
+	}
+}
+
+// cloudEventsAuditSink returns an audit sink calling next, if set, then emitting the event as a CloudEvent to
+// the configured sink.
+func (a *Auth) cloudEventsAuditSink(next func(context.Context, AuditEvent)) func(context.Context, AuditEvent) {
+	return func(ctx context.Context, event AuditEvent) {
+		if next != nil {
+			next(ctx, event)
+		}
+
+		data, err := marshalCloudEvent(a.cloudEventsSource, event)
+		if err != nil {
+			a.logger.Warn("audit event dropped, failed to create cloud event", zap.Error(err))
+
+			return
+		}
+
+		a.cloudEventsSink(ctx, data)
+	}
+}
+
+// marshalCloudEvent returns the CloudEvents json encoding of the audit event.
+func marshalCloudEvent(source string, event AuditEvent) ([]byte, error) {
+	id := make([]byte, cloudEventIDSize)
+
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id),
+		Source:          source,
+		Type:            cloudEventTypePrefix + event.Outcome,
+		Subject:         event.Subject,
+		Time:            event.Time,
+		DataContentType: echo.MIMEApplicationJSON,
+		Data: cloudEventData{
+			Outcome:  event.Outcome,
+			Reason:   event.Reason,
+			Issuer:   event.Issuer,
+			Route:    event.Route,
+			ClientIP: event.ClientIP,
+		},
+	})
+}
+
+// startAudit starts delivering audit events to the sink if configured.
+func (a *Auth) startAudit(ctx context.Context) {
+	if a.cloudEventsSink != nil {
+		a.auditSink = a.cloudEventsAuditSink(a.auditSink)
+	}
+
+	if a.auditSink == nil {
+		return
+	}
+
+	a.auditEvents = make(chan auditEntry, auditBufferSize)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case entry := <-a.auditEvents:
+				a.auditSink(entry.ctx, entry.event)
+			}
+		}
+	}()
+}
+
+// audit queues an audit event for the request with the provided outcome and error.
+func (a *Auth) audit(c echo.Context, outcome string, err error) {
+	if a.auditEvents == nil {
+		return
+	}
+
+	event := AuditEvent{
+		Time:     a.now(),
+		Outcome:  outcome,
+		Route:    c.Path(),
+		ClientIP: c.RealIP(),
+	}
+
+	if err != nil {
+		event.Reason = ErrorReason(err)
+	}
+
+	if token, ok := c.Get(a.contextKey()).(*jwt.Token); ok && token != nil {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			event.Subject, _ = claims[a.subjectClaimName()].(string)
+			event.Issuer, _ = claims["iss"].(string)
+		}
+	}
+
+	if outcome == AuditOutcomeAPIKey {
+		event.Subject = Actor(c)
+	}
+
+	select {
+	case a.auditEvents <- auditEntry{ctx: detachedContext{c.Request().Context()}, event: event}:
+	default:
+		a.requestLogger(c).Warn("audit event dropped, audit sink is not keeping up")
+	}
+}
@@ -0,0 +1,242 @@
+package echojwtx_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestAuditSink(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan echojwtx.AuditEvent, 1)
+
+	auth, err := echojwtx.NewAuth(ctx,
+		echojwtx.AuthConfig{
+			Issuer:   issuer,
+			Audience: "testaud",
+		},
+		echojwtx.WithAuditSink(func(_ context.Context, event echojwtx.AuditEvent) {
+			events <- event
+		}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name          string
+		audience      string
+		expectOutcome string
+		expectReason  string
+	}{
+		{
+			"authenticated",
+			"testaud",
+			echojwtx.AuditOutcomeSuccess,
+			"",
+		},
+		{
+			"rejected",
+			"otheraud",
+			echojwtx.AuditOutcomeFailure,
+			echojwtx.ReasonInvalidAudience,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token := testHelperMustSignClaims(map[string]interface{}{
+				"iss": issuer,
+				"sub": "urn:test:user",
+				"aud": tc.audience,
+			})
+
+			req := testHelperRequest(http.MethodGet, "/test/1", token)
+			req.RemoteAddr = "192.0.2.1:1234"
+
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			select {
+			case event := <-events:
+				assert.Equal(t, tc.expectOutcome, event.Outcome, "unexpected outcome")
+				assert.Equal(t, tc.expectReason, event.Reason, "unexpected reason")
+				assert.Equal(t, "urn:test:user", event.Subject, "unexpected subject")
+				assert.Equal(t, issuer, event.Issuer, "unexpected issuer")
+				assert.Equal(t, "/test/:id", event.Route, "unexpected route")
+				assert.Equal(t, "192.0.2.1", event.ClientIP, "unexpected client ip")
+				assert.False(t, event.Time.IsZero(), "expected event time")
+				assert.NotContains(t, []string{event.Subject, event.Issuer, event.Reason, event.Route}, token, "expected event not to contain token")
+			case <-time.After(time.Second):
+				t.Fatal("expected audit event")
+			}
+		})
+	}
+}
+
+func TestCloudEventsAudit(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan []byte, 1)
+
+	auth, err := echojwtx.NewAuth(ctx,
+		echojwtx.AuthConfig{
+			Issuer:   issuer,
+			Audience: "testaud",
+		},
+		echojwtx.WithCloudEventsAudit("https://api.example.com", func(_ context.Context, event []byte) {
+			events <- event
+		}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	token := testHelperMustSignClaims(map[string]interface{}{
+		"iss":   issuer,
+		"sub":   "urn:test:user",
+		"aud":   "otheraud",
+		"email": "user@example.com",
+	})
+
+	req := testHelperRequest(http.MethodGet, "/test/1", token)
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	var raw []byte
+
+	select {
+	case raw = <-events:
+	case <-time.After(time.Second):
+		require.Fail(t, "expected audit event")
+	}
+
+	assert.NotContains(t, string(raw), token, "expected token to be excluded")
+	assert.NotContains(t, string(raw), "user@example.com", "expected claims to be excluded")
+
+	var event map[string]interface{}
+
+	require.NoError(t, json.Unmarshal(raw, &event), "no error expected decoding cloud event")
+
+	assert.Equal(t, "1.0", event["specversion"], "unexpected specversion")
+	assert.NotEmpty(t, event["id"], "expected event id")
+	assert.Equal(t, "https://api.example.com", event["source"], "unexpected source")
+	assert.Equal(t, "com.infratographer.echojwtx.auth.failure", event["type"], "unexpected type")
+	assert.Equal(t, "urn:test:user", event["subject"], "unexpected subject")
+	assert.Equal(t, "application/json", event["datacontenttype"], "unexpected datacontenttype")
+
+	_, err = time.Parse(time.RFC3339Nano, event["time"].(string))
+	assert.NoError(t, err, "expected rfc3339 event time")
+
+	assert.Equal(t, map[string]interface{}{
+		"outcome":   echojwtx.AuditOutcomeFailure,
+		"reason":    echojwtx.ReasonInvalidAudience,
+		"issuer":    issuer,
+		"route":     "/test/:id",
+		"client_ip": "192.0.2.1",
+	}, event["data"], "unexpected event data")
+}
+
+func TestCloudEventsAuditWithAuditSink(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	testCases := []struct {
+		name             string
+		cloudEventsFirst bool
+	}{
+		{
+			"audit sink first",
+			false,
+		},
+		{
+			"cloud events first",
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			events := make(chan echojwtx.AuditEvent, 1)
+			cloudEvents := make(chan []byte, 1)
+
+			opts := []echojwtx.Opts{
+				echojwtx.WithAuditSink(func(_ context.Context, event echojwtx.AuditEvent) {
+					events <- event
+				}),
+				echojwtx.WithCloudEventsAudit("https://api.example.com", func(_ context.Context, event []byte) {
+					cloudEvents <- event
+				}),
+			}
+
+			if tc.cloudEventsFirst {
+				opts[0], opts[1] = opts[1], opts[0]
+			}
+
+			auth, err := echojwtx.NewAuth(ctx, echojwtx.AuthConfig{Issuer: issuer}, opts...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			e.ServeHTTP(httptest.NewRecorder(), testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+				"iss": issuer,
+				"sub": "urn:test:user",
+			})))
+
+			select {
+			case event := <-events:
+				assert.Equal(t, echojwtx.AuditOutcomeSuccess, event.Outcome, "unexpected outcome")
+			case <-time.After(time.Second):
+				require.Fail(t, "expected audit sink event")
+			}
+
+			select {
+			case <-cloudEvents:
+			case <-time.After(time.Second):
+				require.Fail(t, "expected cloud event")
+			}
+		})
+	}
+}
@@ -16,16 +16,22 @@ package echojwtx
 
 import (
 	"context"
-	"encoding/json"
+	"crypto"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"net/http"
-	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/MicahParks/keyfunc/v2"
+	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.uber.org/zap"
 )
@@ -39,10 +45,17 @@ var (
 
 type actorContext struct{}
 
+type authenticatedAtContext struct{}
+
+type identityContext struct{}
+
 const (
 	// ActorKey defines the context key an actor is stored in for an echo context
 	ActorKey = "actor"
 
+	// requestStartKey defines the echo context key the time the middleware received the request is stored in.
+	requestStartKey = "echojwtx.request_start"
+
 	// DefaultKeyFuncOptionRefreshInterval defines the frequency at which the jwks file is refreshed.
 	DefaultKeyFuncOptionRefreshInterval = time.Hour
 
@@ -51,6 +64,17 @@ const (
 
 	// DefaultKeyFuncOptionRefreshTimeout limits the runtime of a reload of jwks.
 	DefaultKeyFuncOptionRefreshTimeout = 10 * time.Second
+
+	// KeySourceDiscovery is the key source when keys are resolved from the JWKS found by oidc discovery.
+	KeySourceDiscovery = "discovery"
+
+	// KeySourceInjectedKeyfunc is the key source when keys are resolved by a KeyFunc provided in the JWTConfig
+	// or with WithKeyfunc.
+	KeySourceInjectedKeyfunc = "injected-keyfunc"
+
+	// KeySourceStaticKeys is the key source when keys are resolved from the public keys provided with
+	// WithPublicKeys.
+	KeySourceStaticKeys = "static-keys"
 )
 
 var (
@@ -59,8 +83,29 @@ var (
 
 	// ErrJWKSURIMissing is returned when the jwks_uri field is not found in the issuer's oidc well-known configuration.
 	ErrJWKSURIMissing = errors.New("jwks_uri missing from oidc provider")
+
+	// ErrAuthNotConfigured is returned by a fail closed middleware when Auth is nil or was not created with NewAuth.
+	ErrAuthNotConfigured = errors.New("auth middleware not configured")
+
+	// ErrKeyfuncRequired is returned by WrapJWTConfig when the provided config has no KeyFunc.
+	ErrKeyfuncRequired = errors.New("jwt config keyfunc required")
+
+	// ErrInvalidAudienceQuorum is returned when the audience quorum is not between one and the number of audiences.
+	ErrInvalidAudienceQuorum = errors.New("audience quorum must be between one and the number of audiences")
+
+	// ErrClockSkewTooLarge is returned when the clock skew or an expiry grace period exceeds five minutes without
+	// WithAllowLargeClockSkew.
+	ErrClockSkewTooLarge = errors.New("clock skew exceeds maximum")
+
+	// FailClosed when set causes Middleware to reject all requests when Auth is nil or was not created with NewAuth.
+	// By default such middleware allows all requests unauthenticated.
+	FailClosed atomic.Bool
 )
 
+// notConfiguredRejectWarning and notConfiguredAllowWarning log the warnings for middleware of an unconfigured
+// Auth only once, as Middleware may be called for every route or gRPC stream.
+var notConfiguredRejectWarning, notConfiguredAllowWarning sync.Once
+
 // Opts defines options for the Auth middleware.
 type Opts func(*Auth)
 
@@ -88,8 +133,126 @@ type Auth struct {
 	// KeyFuncOptions configuration for fetching JWKS.
 	KeyFuncOptions keyfunc.Options
 
-	issuer   string
-	audience string
+	issuer      string
+	audience    string
+	keySource   string
+	keyFunc     jwt.Keyfunc
+	staticKeys  bool
+	tokenLookup string
+
+	supportedAlgorithms []string
+	setupInfo           SetupInfo
+
+	audienceByMethod map[string]string
+	audienceByPrefix map[string]string
+	claimHeaders     map[string]string
+	contextClaims    map[string]string
+	loggerContextKey string
+	issuerAliases    map[string][]string
+	fallbackIssuers  []string
+
+	audienceClaimPath string
+
+	audienceQuorum  int
+	quorumAudiences []string
+
+	audienceProvider    *audienceProvider
+	audienceProviderTTL time.Duration
+
+	issuerAudiencePairs []IssuerAudiencePair
+	rejectIssuerAsAud   bool
+
+	tenantHeader  string
+	tenantIssuers map[string]string
+
+	allowedKIDs                  []string
+	noUnknownKIDRefresh          bool
+	syncRefreshTimeout           time.Duration
+	noDiscoveryIssuerCheck       bool
+	noStrictDiscoveryContentType bool
+	caseSensitiveScheme          bool
+	duplicateAuthHeaderPolicy    DuplicateAuthHeaderPolicy
+	discoveryIssuer              string
+	discoveryRefresh             time.Duration
+	discoveryHeaders             http.Header
+
+	breaker            *circuitBreaker
+	metricsRegisterer  prometheus.Registerer
+	metricsClaimLabel  string
+	authMetrics        *authMetrics
+	rootCAs            *x509.CertPool
+	rootCAClient       *http.Client
+	issuerHTTPClients  map[string]*http.Client
+	additionalJWKSURIs map[string][]string
+	standbyJWKSURI     string
+	onKeysChanged      func(keyIDs []string)
+	keysChangedInitial bool
+
+	subjectValidator func(sub string) error
+	nonceValidator   func(c echo.Context) string
+	sessionCookie    string
+	sessionLookup    func(sid string) bool
+	claimValidators  []func(ctx context.Context, claims jwt.MapClaims) error
+	subjectClaim     string
+	requireSubject   bool
+
+	scopeSeparator string
+	requiredScopes []string
+	anyScopes      []string
+
+	keycloakClientID string
+	keycloakRoles    []string
+
+	debugRoutes          bool
+	storeAuthenticatedAt bool
+	clearContext         bool
+	neverReject          bool
+	dryRun               bool
+	dryRunReason         func(c echo.Context, err error)
+
+	apiKeyHeader    string
+	apiKeyValidator func(key string) (actor string, ok bool)
+
+	downstreamTokenMinter   func(claims jwt.MapClaims) (string, error)
+	downstreamTokenRequired bool
+
+	atHashAccessToken  func(c echo.Context) string
+	certificateBinding bool
+
+	clock            func() time.Time
+	clockSkew        time.Duration
+	allowLargeSkew   bool
+	expiryGrace      map[string]time.Duration
+	verifyIssuedAt   bool
+	issuedAtLeeway   time.Duration
+	maxTokenLifetime time.Duration
+	minIssuedAt      atomic.Pointer[time.Time]
+	issuedAtWindow   bool
+	issuedAtMaxAge   time.Duration
+	issuedAtMaxAhead time.Duration
+
+	lastInfraError     atomic.Pointer[infraError]
+	lastDiscoveryError atomic.Pointer[infraError]
+
+	trustEmbeddedJWK func(*jwt.Token) bool
+
+	trustedThumbprints []string
+
+	slowValidationThreshold time.Duration
+	slowValidation          func(c echo.Context, took time.Duration)
+
+	auditSink         func(context.Context, AuditEvent)
+	auditEvents       chan auditEntry
+	cloudEventsSource string
+	cloudEventsSink   func(context.Context, []byte)
+
+	reasonHeader string
+	errorHandler func(c echo.Context, err error) error
+
+	tokenCache *tokenCache
+
+	jweDecrypter   func(raw string) (string, error)
+	parseTokenFunc func(c echo.Context, auth string) (interface{}, error)
 }
 
 // WithLogger sets the logger for the auth middleware.
@@ -106,6 +269,32 @@ func WithJWTConfig(jwtConfig echojwt.Config) Opts {
 	}
 }
 
+// WithKeyfunc sets the keyfunc used to resolve token keys, skipping oidc discovery and JWKS fetching entirely.
+// This takes precedence over a KeyFunc in the JWTConfig regardless of the order options are provided in.
+func WithKeyfunc(keyFunc jwt.Keyfunc) Opts {
+	return func(a *Auth) {
+		a.keyFunc = keyFunc
+		a.staticKeys = false
+	}
+}
+
+// WithPublicKeys resolves token keys from the provided public keys by the token's kid header, skipping oidc
+// discovery and JWKS fetching entirely, such as keys shipped as PEM files to offline deployments. Keys may be
+// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey values. Tokens whose kid has no matching key are rejected,
+// while the issuer and audience are still validated. This replaces a keyfunc set by WithKeyfunc.
+func WithPublicKeys(keys map[string]crypto.PublicKey) Opts {
+	return func(a *Auth) {
+		given := make(map[string]keyfunc.GivenKey, len(keys))
+
+		for kid, key := range keys {
+			given[kid] = keyfunc.NewGivenCustom(key, keyfunc.GivenKeyOptions{})
+		}
+
+		a.keyFunc = keyfunc.NewGiven(given).Keyfunc
+		a.staticKeys = true
+	}
+}
+
 // WithKeyFuncOptions sets the KeyFuncOptions for the auth middleware.
 func WithKeyFuncOptions(keyFuncOptions keyfunc.Options) Opts {
 	return func(a *Auth) {
@@ -113,6 +302,273 @@ func WithKeyFuncOptions(keyFuncOptions keyfunc.Options) Opts {
 	}
 }
 
+// WithAudienceByMethod sets the required audience for specific request methods.
+// Methods not in the map use the configured default audience.
+func WithAudienceByMethod(audiences map[string]string) Opts {
+	return func(a *Auth) {
+		a.audienceByMethod = make(map[string]string, len(audiences))
+
+		for method, audience := range audiences {
+			a.audienceByMethod[strings.ToUpper(method)] = audience
+		}
+	}
+}
+
+// WithAudienceByPathPrefix sets the required audience for request paths starting with specific prefixes, such as
+// products mounted under different paths. The longest matching prefix selects the audience and paths matching no
+// prefix use the configured default audience. Prefixes are matched as plain strings, so "/api" also matches
+// "/apiv2", include a trailing slash to match a single path segment. An audience set by WithAudienceByMethod
+// takes precedence.
+func WithAudienceByPathPrefix(audiences map[string]string) Opts {
+	return func(a *Auth) {
+		a.audienceByPrefix = make(map[string]string, len(audiences))
+
+		for prefix, audience := range audiences {
+			a.audienceByPrefix[prefix] = audience
+		}
+	}
+}
+
+// WithClaimHeaders sets request headers from validated token claims.
+// The map keys are claim names and the values are the header names to set.
+// Any headers with the same names provided by the client are removed before validation.
+func WithClaimHeaders(headers map[string]string) Opts {
+	return func(a *Auth) {
+		a.claimHeaders = headers
+	}
+}
+
+// WithContextClaims sets echo context values from validated token claims.
+// The map keys are claim names and the values are the echo context keys to set.
+// Claims missing from a token are not set.
+func WithContextClaims(mapping map[string]string) Opts {
+	return func(a *Auth) {
+		a.contextClaims = mapping
+	}
+}
+
+// WithIssuerAliases sets additional issuer values which are accepted as equivalent to an issuer.
+// The map keys are issuers and the values are the aliases accepted for that issuer.
+//
+// This is a compatibility shim for providers which issue tokens with an issuer which differs from their
+// discovery issuer, such as Google issuing tokens with the scheme-less issuer accounts.google.com.
+func WithIssuerAliases(aliases map[string][]string) Opts {
+	return func(a *Auth) {
+		a.issuerAliases = aliases
+	}
+}
+
+// WithFallbackIssuers sets issuers which are tried in order when discovery for the configured issuer fails,
+// such as a backup provider mirroring the primary provider's keys. Keys are only loaded from the first issuer
+// which is discovered successfully, while tokens from the configured issuer or any fallback issuer are accepted.
+// If no issuer can be discovered NewAuth fails with the errors of every attempt.
+//
+// This differs from WithTenantIssuerMap which selects the issuer per request, and from WithIssuerAliases
+// which only accepts alternate iss values without discovering them.
+func WithFallbackIssuers(issuers ...string) Opts {
+	return func(a *Auth) {
+		a.fallbackIssuers = issuers
+	}
+}
+
+// WithAudienceClaimPath sets the dotted claim path the audience is read from instead of the aud claim.
+// For example "resource_access.client.audience". The value at the path may be a string or an array of strings.
+func WithAudienceClaimPath(path string) Opts {
+	return func(a *Auth) {
+		a.audienceClaimPath = path
+	}
+}
+
+// WithIssuerHTTPClient sets the http client used for discovery and JWKS requests to the provided issuer.
+// Issuers without a specific client use the default client.
+//
+// A client whose transport dials a Unix domain socket fetches discovery and JWKS from a local agent, such as a
+// sidecar, with an issuer like http://unix, as the host is ignored by the dialer:
+//
+//	client := &http.Client{
+//		Transport: &http.Transport{
+//			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+//				return (&net.Dialer{}).DialContext(ctx, "unix", "/run/idp/agent.sock")
+//			},
+//		},
+//	}
+//
+//	auth, err := NewAuth(ctx, AuthConfig{Issuer: "http://unix"}, WithIssuerHTTPClient("http://unix", client))
+func WithIssuerHTTPClient(issuer string, client *http.Client) Opts {
+	return func(a *Auth) {
+		if a.issuerHTTPClients == nil {
+			a.issuerHTTPClients = make(map[string]*http.Client)
+		}
+
+		a.issuerHTTPClients[issuer] = client
+	}
+}
+
+// WithAdditionalJWKSURIs sets additional JWKS URIs which are consulted along with the discovered JWKS when
+// resolving a token's key id for the provided issuer. A token signed by a key in any of the JWKS validates.
+// This is useful during key migrations where upcoming keys are published at a separate URI.
+func WithAdditionalJWKSURIs(issuer string, uris ...string) Opts {
+	return func(a *Auth) {
+		if a.additionalJWKSURIs == nil {
+			a.additionalJWKSURIs = make(map[string][]string)
+		}
+
+		a.additionalJWKSURIs[issuer] = append(a.additionalJWKSURIs[issuer], uris...)
+	}
+}
+
+// WithAuthenticatedAt enables storing the time the request was authenticated in the request context.
+// The time is retrieved with AuthenticatedAt.
+func WithAuthenticatedAt() Opts {
+	return func(a *Auth) {
+		a.storeAuthenticatedAt = true
+	}
+}
+
+// WithTenantIssuerMap requires the token issuer to match the issuer mapped to the tenant in the provided request
+// header. The mapping keys are tenant header values and the values are the expected issuers.
+// Requests missing the header, for unknown tenants or with a mismatched issuer are rejected with a 403.
+func WithTenantIssuerMap(header string, mapping map[string]string) Opts {
+	return func(a *Auth) {
+		a.tenantHeader = header
+		a.tenantIssuers = mapping
+	}
+}
+
+// WithClearContextOnResponse removes the auth values stored in the echo and request contexts after the
+// handler returns, so they are not available to middleware running after the response is handled.
+func WithClearContextOnResponse() Opts {
+	return func(a *Auth) {
+		a.clearContext = true
+	}
+}
+
+// WithSubjectValidator sets a function which validates the token's subject claim after signature validation.
+// The subject is empty if the claim is missing. A returned error rejects the request with a 401.
+func WithSubjectValidator(fn func(sub string) error) Opts {
+	return func(a *Auth) {
+		a.subjectValidator = fn
+	}
+}
+
+// WithRequireNonEmptySubject sets whether tokens with a missing or empty subject claim are rejected with a 401,
+// instead of being accepted with an empty actor. The subject claim is the sub claim unless changed with
+// WithSubjectClaim. This is disabled by default and is planned to be enabled by default in a future version.
+func WithRequireNonEmptySubject(enabled bool) Opts {
+	return func(a *Auth) {
+		a.requireSubject = enabled
+	}
+}
+
+// WithNeverReject never rejects requests, populating the actor and claims only for requests with a fully valid
+// token. Requests without a token or with an invalid token are passed to the next handler unauthenticated and the
+// failure is logged as a warning. Any ErrorHandler in the JWTConfig is not called.
+//
+// Endpoints using this mode are effectively unauthenticated: any client can call them, so handlers must treat a
+// missing actor as anonymous and never use this mode to protect data or actions.
+func WithNeverReject() Opts {
+	return func(a *Auth) {
+		a.neverReject = true
+	}
+}
+
+// WithDryRun disables enforcement entirely: every validation still runs, but failures are only logged and reported
+// to the provided function, which may be nil, while the request always proceeds. This allows measuring how many
+// requests a new policy, such as a required scope or audience, would reject before enforcing it.
+//
+// Requests with a validly signed token which fail a claim validation proceed with the actor and claims set as
+// though the validation had passed. Requests without a token or with a token which can't be verified proceed
+// unauthenticated as with WithNeverReject. Middleware registered separately, such as RequireScopes and
+// RequireActor, still enforces its own checks. Never use this mode to protect data or actions.
+func WithDryRun(reason func(c echo.Context, err error)) Opts {
+	return func(a *Auth) {
+		a.dryRun = true
+		a.dryRunReason = reason
+		a.neverReject = true
+	}
+}
+
+// reportDryRun logs and reports a validation failure which would have rejected the request if not for dry run.
+func (a *Auth) reportDryRun(c echo.Context, err error) {
+	a.requestLogger(c).Warn("jwt user would be rejected, dry run enabled", zap.Error(err))
+
+	if a.dryRunReason != nil {
+		a.dryRunReason(c, err)
+	}
+}
+
+// continueUnauthenticated logs the rejection of a request which continues unauthenticated and removes the token.
+// Requests without a token are only logged at debug level as they are expected.
+func (a *Auth) continueUnauthenticated(c echo.Context, err error) {
+	if ErrorReason(err) == ReasonMissingToken {
+		a.requestLogger(c).Debug("jwt user missing, continuing unauthenticated", zap.Error(err))
+	} else {
+		a.requestLogger(c).Warn("jwt user rejected, continuing unauthenticated", zap.Error(err))
+	}
+
+	c.Set(a.contextKey(), nil)
+}
+
+// WithSubjectClaim sets the claim the actor is read from instead of the sub claim, for issuers which identify
+// users with a different claim such as uid. The claim is also used as the Identity subject and by the subject
+// validator. Tokens without the claim are accepted without an actor, use WithRequireNonEmptySubject to reject
+// them with a 401.
+func WithSubjectClaim(name string) Opts {
+	return func(a *Auth) {
+		a.subjectClaim = name
+	}
+}
+
+// subjectClaimName returns the name of the claim the actor is read from.
+func (a *Auth) subjectClaimName() string {
+	if a.subjectClaim == "" {
+		return "sub"
+	}
+
+	return a.subjectClaim
+}
+
+// WithAudienceQuorum requires at least n of the provided audiences to be present in the token's audience.
+// n must be between one and the number of audiences provided.
+func WithAudienceQuorum(n int, auds ...string) Opts {
+	return func(a *Auth) {
+		a.audienceQuorum = n
+		a.quorumAudiences = auds
+	}
+}
+
+// IssuerAudiencePair is an issuer and an audience tokens from the issuer are accepted for.
+type IssuerAudiencePair struct {
+	Issuer   string
+	Audience string
+}
+
+// WithIssuerAudiencePairs only accepts tokens whose issuer and one of whose audiences form one of the provided
+// pairs, such as tokens from a partner issuer which are only accepted for specific audiences. The pairing is
+// enforced in addition to the issuer and audience validations, so each issuer must also be accepted, for example
+// as a fallback issuer, and its keys resolvable. Tokens not matching a pair are rejected with a 401.
+func WithIssuerAudiencePairs(pairs []IssuerAudiencePair) Opts {
+	return func(a *Auth) {
+		a.issuerAudiencePairs = pairs
+	}
+}
+
+// WithRejectIssuerAsAudience rejects tokens with their own issuer as one of their audiences with a 401, a sign of
+// a misissued token or of a token mix-up, such as an issuer's internal token replayed to a service.
+func WithRejectIssuerAsAudience() Opts {
+	return func(a *Auth) {
+		a.rejectIssuerAsAud = true
+	}
+}
+
+// WithRefreshOnUnknownKID sets whether the JWKS is refreshed when a token has an unknown key id.
+// This is enabled by default so keys added during a rollover are found, subject to the refresh rate limit.
+func WithRefreshOnUnknownKID(enabled bool) Opts {
+	return func(a *Auth) {
+		a.noUnknownKIDRefresh = !enabled
+	}
+}
+
 func (a *Auth) setup(ctx context.Context, config AuthConfig, options ...Opts) error {
 	for _, opt := range options {
 		opt(a)
@@ -123,6 +579,28 @@ func (a *Auth) setup(ctx context.Context, config AuthConfig, options ...Opts) er
 		a.logger = zap.NewNop()
 	}
 
+	if a.audienceQuorum != 0 && (a.audienceQuorum < 1 || a.audienceQuorum > len(a.quorumAudiences)) {
+		return ErrInvalidAudienceQuorum
+	}
+
+	if a.clockSkew > maxClockSkew && !a.allowLargeSkew {
+		return fmt.Errorf("%w: %s is above %s", ErrClockSkewTooLarge, a.clockSkew, maxClockSkew)
+	}
+
+	for method, grace := range a.expiryGrace {
+		if grace > maxClockSkew && !a.allowLargeSkew {
+			return fmt.Errorf("%w: %s expiry grace %s is above %s", ErrClockSkewTooLarge, method, grace, maxClockSkew)
+		}
+	}
+
+	if a.metricsRegisterer != nil {
+		var err error
+
+		if a.authMetrics, err = newAuthMetrics(a.metricsRegisterer, a.metricsClaimLabel); err != nil {
+			return err
+		}
+	}
+
 	if config.RefreshTimeout > 0 {
 		a.KeyFuncOptions.RefreshTimeout = config.RefreshTimeout
 	}
@@ -130,16 +608,48 @@ func (a *Auth) setup(ctx context.Context, config AuthConfig, options ...Opts) er
 	a.issuer = config.Issuer
 	a.audience = config.Audience
 
+	if a.keyFunc != nil {
+		a.JWTConfig.KeyFunc = a.keyFunc
+	}
+
+	if a.tokenLookup != "" {
+		a.JWTConfig.TokenLookup = a.tokenLookup
+	}
+
+	if err := a.setupRootCAs(); err != nil {
+		return err
+	}
+
+	if a.breaker != nil {
+		a.breaker.now = a.now
+	}
+
+	a.keySource = KeySourceInjectedKeyfunc
+
+	if a.staticKeys {
+		a.keySource = KeySourceStaticKeys
+	}
+
 	if a.JWTConfig.KeyFunc == nil {
-		jwksURI, err := jwksURI(ctx, a.issuer)
+		a.keySource = KeySourceDiscovery
+
+		issuer, discovery, err := a.discoverIssuers(ctx)
 		if err != nil {
 			return err
 		}
 
+		if issuerClient := a.issuerHTTPClients[issuer]; issuerClient != nil {
+			a.KeyFuncOptions.Client = issuerClient
+		}
+
 		if a.KeyFuncOptions.Client == nil {
 			a.KeyFuncOptions.Client = otelhttp.DefaultClient
 		}
 
+		client := a.KeyFuncOptions.Client
+
+		a.KeyFuncOptions.Client = a.breaker.client(client)
+
 		if a.KeyFuncOptions.Ctx == nil {
 			a.KeyFuncOptions.Ctx = ctx
 		}
@@ -150,6 +660,13 @@ func (a *Auth) setup(ctx context.Context, config AuthConfig, options ...Opts) er
 			}
 		}
 
+		a.KeyFuncOptions.RefreshErrorHandler = a.infraRefreshErrorHandler(a.KeyFuncOptions.RefreshErrorHandler)
+		a.KeyFuncOptions.ResponseExtractor = a.infraResponseExtractor(a.KeyFuncOptions.ResponseExtractor)
+
+		if a.onKeysChanged != nil {
+			a.KeyFuncOptions.ResponseExtractor = a.keyChangeExtractor(a.KeyFuncOptions.ResponseExtractor)
+		}
+
 		if a.KeyFuncOptions.RefreshInterval == 0 {
 			a.KeyFuncOptions.RefreshInterval = DefaultKeyFuncOptionRefreshInterval
 		}
@@ -162,14 +679,98 @@ func (a *Auth) setup(ctx context.Context, config AuthConfig, options ...Opts) er
 			a.KeyFuncOptions.RefreshTimeout = DefaultKeyFuncOptionRefreshTimeout
 		}
 
-		a.KeyFuncOptions.RefreshUnknownKID = true
+		if len(a.discoveryHeaders) != 0 {
+			a.KeyFuncOptions.RequestFactory = a.jwksRequestFactory()
+		}
 
-		jwks, err := keyfunc.Get(jwksURI, a.KeyFuncOptions)
-		if err != nil {
-			return err
+		// unknown key ids are refreshed by jwksKeyfunc to coalesce concurrent refreshes.
+		a.KeyFuncOptions.RefreshUnknownKID = false
+
+		uris := append([]string{discovery.JWKSURI}, a.additionalJWKSURIs[issuer]...)
+
+		kf := &jwksKeyfunc{
+			ctx:               a.KeyFuncOptions.Ctx,
+			refreshUnknownKID: !a.noUnknownKIDRefresh,
+			refreshTimeout:    a.syncRefreshTimeout,
+			breaker:           a.breaker,
+		}
+
+		if a.metricsRegisterer != nil {
+			if kf.metrics, err = newJWKSMetrics(a.metricsRegisterer); err != nil {
+				return err
+			}
+		}
+
+		options := a.KeyFuncOptions
+
+		if a.standbyJWKSURI != "" {
+			// the standby has its own breaker so it is still refreshed while the primary's breaker is open.
+			standbyOptions := a.KeyFuncOptions
+			standbyOptions.Client = a.breaker.fork().client(client)
+
+			standby, err := keyfunc.Get(a.standbyJWKSURI, standbyOptions)
+			if err != nil {
+				return err
+			}
+
+			kf.standby = standby
+
+			// the standby takes over while the primary jwks is unavailable, including at startup.
+			options.TolerateInitialJWKHTTPError = true
+		}
+
+		sets := make([]*keyfunc.JWKS, len(uris))
+
+		for i, uri := range uris {
+			jwks, err := keyfunc.Get(uri, options)
+			if err != nil {
+				return err
+			}
+
+			sets[i] = jwks
+		}
+
+		kf.sets.Store(&sets)
+
+		a.JWTConfig.KeyFunc = kf.Keyfunc
+		a.supportedAlgorithms = discovery.SupportedAlgorithms
+
+		if a.discoveryRefresh > 0 {
+			go a.refreshDiscovery(a.KeyFuncOptions.Ctx, issuer, discovery.JWKSURI, kf)
 		}
 
-		a.JWTConfig.KeyFunc = jwks.Keyfunc
+		a.setupInfo = SetupInfo{
+			Issuer:     issuer,
+			JWKSURIs:   uris,
+			KeyCount:   kf.keyCount(),
+			Algorithms: kf.algorithms(),
+		}
+	}
+
+	a.setupInfo.KeySource = a.keySource
+
+	if a.trustEmbeddedJWK != nil {
+		a.JWTConfig.KeyFunc = a.embeddedJWKKeyfunc(a.JWTConfig.KeyFunc)
+	}
+
+	if len(a.trustedThumbprints) != 0 {
+		a.JWTConfig.KeyFunc = a.trustedThumbprintKeyfunc(a.JWTConfig.KeyFunc)
+	}
+
+	if a.allowedKIDs != nil {
+		a.JWTConfig.KeyFunc = a.allowedKIDKeyfunc(a.JWTConfig.KeyFunc)
+	}
+
+	a.startAudit(ctx)
+
+	a.parseTokenFunc = a.JWTConfig.ParseTokenFunc
+	a.JWTConfig.ParseTokenFunc = a.parseToken
+
+	a.errorHandler = a.JWTConfig.ErrorHandler
+	a.JWTConfig.ErrorHandler = a.handleTokenError
+
+	if a.neverReject {
+		a.JWTConfig.ContinueOnIgnoredError = true
 	}
 
 	mdw, err := a.JWTConfig.ToMiddleware()
@@ -189,22 +790,140 @@ func (a *Auth) setup(ctx context.Context, config AuthConfig, options ...Opts) er
 				return next(c)
 			}
 
+			if a.neverReject && c.Get(a.contextKey()) == nil {
+				// the token was rejected and already logged by handleTokenError.
+				return next(c)
+			}
+
 			if err := a.jwtHandler(c); err != nil {
-				return err
+				a.authFailed(c, err)
+
+				if a.neverReject {
+					a.continueUnauthenticated(c, err)
+
+					return next(c)
+				}
+
+				setInsufficientScopeChallenge(c, err)
+
+				return rejectionError(err)
 			}
 
+			a.finishValidation(c)
+			a.audit(c, AuditOutcomeSuccess, nil)
+			a.recordMetrics(c, AuditOutcomeSuccess, nil)
+
 			return next(c)
 		}
 
-		return mdw(postActions)
+		handler := mdw(postActions)
+
+		return func(c echo.Context) error {
+			if a.clearContext {
+				defer a.restoreContext(c, c.Request().Context(), c.Get(a.loggerContextKey))
+			}
+
+			if a.storeAuthenticatedAt {
+				c.Set(requestStartKey, a.now())
+			}
+
+			a.stripClaimHeaders(c)
+
+			if !skipper(c) {
+				a.startValidation(c)
+
+				if actor, ok := a.apiKeyActor(c); ok {
+					ContextWithActor(c, actor)
+
+					a.finishValidation(c)
+					a.audit(c, AuditOutcomeAPIKey, nil)
+					a.recordMetrics(c, AuditOutcomeAPIKey, nil)
+
+					return next(c)
+				}
+
+				if err := a.checkDuplicateAuthHeader(c); err != nil {
+					return a.tokenError(c, next, err)
+				}
+
+				if err := a.checkEmptyBearer(c); err != nil {
+					return a.tokenError(c, next, err)
+				}
+
+				if err := a.checkSchemeCase(c); err != nil {
+					return a.tokenError(c, next, err)
+				}
+			}
+
+			return handler(c)
+		}
 	}
 
 	return nil
 }
 
+// restoreContext restores the request context and removes the auth values stored in the echo context.
+// The enriched logger is replaced by the logger stored before the request was authenticated, if any.
+func (a *Auth) restoreContext(c echo.Context, ctx context.Context, logger interface{}) {
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	if a.loggerContextKey != "" {
+		c.Set(a.loggerContextKey, logger)
+	}
+
+	keys := []string{a.contextKey(), ActorKey, requestStartKey, validationStartKey}
+
+	for _, key := range a.contextClaims {
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		if c.Get(key) != nil {
+			c.Set(key, nil)
+		}
+	}
+}
+
+// contextKey returns the echo context key the parsed token is stored in.
+func (a *Auth) contextKey() string {
+	if a.JWTConfig.ContextKey == "" {
+		return "user"
+	}
+
+	return a.JWTConfig.ContextKey
+}
+
 // Middleware returns echo middleware for validation jwt tokens.
+//
+// The middleware should be registered with Echo#Use or on a group or route so it runs after routing
+// and logs include the matched route pattern. Middleware registered with Echo#Pre runs before routing.
+//
+// Rejected requests return an *echo.HTTPError, never writing the response directly, so the echo
+// HTTPErrorHandler renders them like any other error. Missing and invalid tokens are rejected with a 401,
+// tokens which are valid but not permitted with a 403 and tokens which couldn't be validated because the keys
+// are unavailable with a 503. An ErrorHandler provided in the JWTConfig replaces this for token errors.
+//
+// If Auth is nil or was not created with NewAuth, a warning is logged once to the global zap logger and the
+// returned middleware allows all requests unauthenticated, unless FailClosed is set in which case all
+// requests are rejected.
 func (a *Auth) Middleware() echo.MiddlewareFunc {
 	if a == nil || a.middleware == nil {
+		if FailClosed.Load() {
+			notConfiguredRejectWarning.Do(func() {
+				zap.L().Warn("auth middleware is not configured, rejecting all requests")
+			})
+
+			return func(_ echo.HandlerFunc) echo.HandlerFunc {
+				return func(_ echo.Context) error {
+					return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(ErrAuthNotConfigured)
+				}
+			}
+		}
+
+		notConfiguredAllowWarning.Do(func() {
+			zap.L().Warn("auth middleware is not configured, allowing all requests unauthenticated")
+		})
+
 		return func(next echo.HandlerFunc) echo.HandlerFunc {
 			return next
 		}
@@ -213,6 +932,43 @@ func (a *Auth) Middleware() echo.MiddlewareFunc {
 	return a.middleware
 }
 
+// RequireActor returns echo middleware which rejects requests with a 403 if no actor has been set.
+// It reads the actor set by Middleware, so it must be registered after Middleware has run, for example
+// on a route or group within a group already using Middleware.
+func (a *Auth) RequireActor() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if Actor(c) == "" {
+				return echo.NewHTTPError(http.StatusForbidden, "actor required").SetInternal(errActorRequired)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// KeySource returns the source keys are resolved from, as determined during setup.
+// See KeySourceDiscovery, KeySourceInjectedKeyfunc and KeySourceStaticKeys.
+func (a *Auth) KeySource() string {
+	return a.keySource
+}
+
+// SupportedAlgorithms returns the signing algorithms the issuer advertises in the
+// id_token_signing_alg_values_supported field of its oidc well-known configuration, as discovered during setup.
+// Empty if the issuer doesn't advertise algorithms or keys are resolved by an injected KeyFunc.
+func (a *Auth) SupportedAlgorithms() []string {
+	return a.supportedAlgorithms
+}
+
+// Logger returns the logger used by the auth middleware.
+func (a *Auth) Logger() *zap.Logger {
+	if a == nil || a.logger == nil {
+		return zap.NewNop()
+	}
+
+	return a.logger
+}
+
 // NewAuth creates a new auth middleware handler for JWTs using JWKS.
 func NewAuth(ctx context.Context, config AuthConfig, options ...Opts) (*Auth, error) {
 	auth := new(Auth)
@@ -224,32 +980,52 @@ func NewAuth(ctx context.Context, config AuthConfig, options ...Opts) (*Auth, er
 	return auth, nil
 }
 
-func jwksURI(ctx context.Context, issuer string) (string, error) {
-	uri, err := url.JoinPath(issuer, ".well-known", "openid-configuration")
-	if err != nil {
-		return "", err
+// WrapJWTConfig creates a new auth middleware handler around an existing echojwt config, such as one with its own
+// token lookup and skipper, validating the provided issuer and audience and setting the actor as NewAuth does.
+// The config, including its KeyFunc, is used as-is and no discovery is performed, ErrKeyfuncRequired is returned
+// if the config has no KeyFunc. The config replaces any JWTConfig provided in the options.
+//
+// The middleware isn't bound to a context, so an audit sink set in the options is never stopped. Use NewAuth with
+// WithJWTConfig to bind the middleware to a context.
+func WrapJWTConfig(config echojwt.Config, issuer, audience string, options ...Opts) (*Auth, error) {
+	if config.KeyFunc == nil {
+		return nil, ErrKeyfuncRequired
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
-	if err != nil {
-		return "", err
-	}
+	return NewAuth(context.Background(), AuthConfig{
+		Issuer:   issuer,
+		Audience: audience,
+	}, append(append([]Opts{}, options...), WithJWTConfig(config))...)
+}
 
-	res, err := jwksClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer res.Body.Close() //nolint:errcheck // no need to check
+// SetupInfo describes the key configuration resolved while setting up the auth middleware.
+type SetupInfo struct {
+	// KeySource is the source keys are resolved from. See KeySourceDiscovery, KeySourceInjectedKeyfunc and
+	// KeySourceStaticKeys.
+	KeySource string
 
-	var m map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&m); err != nil {
-		return "", err
-	}
+	// Issuer is the issuer which was discovered, which may be a fallback issuer.
+	// Empty when keys are resolved by an injected KeyFunc.
+	Issuer string
+
+	// JWKSURIs are the JWKS URIs keys are fetched from, starting with the discovered jwks_uri.
+	JWKSURIs []string
 
-	jwksURL, ok := m["jwks_uri"]
-	if !ok {
-		return "", ErrJWKSURIMissing
+	// KeyCount is the number of keys loaded across all JWKS.
+	KeyCount int
+
+	// Algorithms are the distinct algorithms advertised by the loaded keys.
+	// Keys which don't specify an algorithm are not included.
+	Algorithms []string
+}
+
+// NewAuthWithInfo creates a new auth middleware handler as NewAuth does while also returning the
+// SetupInfo resolved during setup, which is useful for logging the resulting configuration at startup.
+func NewAuthWithInfo(ctx context.Context, config AuthConfig, options ...Opts) (*Auth, SetupInfo, error) {
+	auth, err := NewAuth(ctx, config, options...)
+	if err != nil {
+		return nil, SetupInfo{}, err
 	}
 
-	return jwksURL.(string), nil
+	return auth, auth.setupInfo, nil
 }
@@ -0,0 +1,938 @@
+package echojwtx_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"go.infratographer.com/x/echojwtx"
+	authtest "go.infratographer.com/x/testing/auth"
+)
+
+func TestUnconfiguredMiddleware(t *testing.T) {
+	testCases := []struct {
+		name             string
+		auth             *echojwtx.Auth
+		failClosed       bool
+		expectStatusCode int
+	}{
+		{
+			"nil auth fail open",
+			nil,
+			false,
+			http.StatusOK,
+		},
+		{
+			"unconfigured auth fail open",
+			new(echojwtx.Auth),
+			false,
+			http.StatusOK,
+		},
+		{
+			"nil auth fail closed",
+			nil,
+			true,
+			http.StatusInternalServerError,
+		},
+		{
+			"unconfigured auth fail closed",
+			new(echojwtx.Auth),
+			true,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.WarnLevel)
+
+			defer zap.ReplaceGlobals(zap.New(core))()
+
+			echojwtx.FailClosed.Store(tc.failClosed)
+
+			defer echojwtx.FailClosed.Store(false)
+
+			statusCode := testHelperDoRequest(t, http.DefaultClient, tc.auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equal(t, tc.expectStatusCode, statusCode, "unexpected response status")
+
+			tc.auth.Middleware()
+
+			// the warning is only logged the first time unconfigured middleware is created, for each of fail open and closed.
+			assert.LessOrEqual(t, logs.Len(), 1, "expected at most a single warning")
+		})
+	}
+}
+
+func TestKeySource(t *testing.T) {
+	_, issuer, closer := OAuthTestClient("urn:test:user", "")
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	})
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.Equal(t, echojwtx.KeySourceDiscovery, auth.KeySource(), "expected discovery key source")
+
+	auth, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithJWTConfig(echojwt.Config{
+		KeyFunc: func(_ *jwt.Token) (interface{}, error) {
+			return &TestPrivRSAKey1.PublicKey, nil
+		},
+	}))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.Equal(t, echojwtx.KeySourceInjectedKeyfunc, auth.KeySource(), "expected injected keyfunc key source")
+
+	keys := map[string]crypto.PublicKey{TestPrivRSAKey1ID: &TestPrivRSAKey1.PublicKey}
+
+	auth, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithPublicKeys(keys))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.Equal(t, echojwtx.KeySourceStaticKeys, auth.KeySource(), "expected static keys key source")
+
+	auth, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithPublicKeys(keys), echojwtx.WithKeyfunc(func(_ *jwt.Token) (interface{}, error) {
+		return &TestPrivRSAKey1.PublicKey, nil
+	}))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.Equal(t, echojwtx.KeySourceInjectedKeyfunc, auth.KeySource(), "expected keyfunc to replace static keys")
+}
+
+func TestNewAuthWithInfo(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		keys := testHelperJoseJWKSProvider(TestPrivRSAKey2ID)
+		keys.Keys[0].Algorithm = "RS256"
+
+		return c.JSON(http.StatusOK, keys)
+	})
+
+	auth, info, err := echojwtx.NewAuthWithInfo(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithAdditionalJWKSURIs(issuer, srv.URL+"/jwks.json"))
+
+	require.NoError(t, err, "no error expected for NewAuthWithInfo")
+	require.NotNil(t, auth, "expected auth")
+
+	assert.Equal(t, echojwtx.SetupInfo{
+		KeySource:  echojwtx.KeySourceDiscovery,
+		Issuer:     issuer,
+		JWKSURIs:   []string{issuer + "/.well-known/jwks.json", srv.URL + "/jwks.json"},
+		KeyCount:   2,
+		Algorithms: []string{"RS256"},
+	}, info, "unexpected setup info")
+
+	_, info, err = echojwtx.NewAuthWithInfo(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithJWTConfig(echojwt.Config{
+		KeyFunc: func(_ *jwt.Token) (interface{}, error) {
+			return &TestPrivRSAKey1.PublicKey, nil
+		},
+	}))
+
+	require.NoError(t, err, "no error expected for NewAuthWithInfo")
+
+	assert.Equal(t, echojwtx.SetupInfo{KeySource: echojwtx.KeySourceInjectedKeyfunc}, info, "unexpected setup info")
+
+	_, _, err = echojwtx.NewAuthWithInfo(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	})
+
+	require.Error(t, err, "error expected when discovery fails")
+}
+
+func TestVerifyDiscoveryIssuer(t *testing.T) {
+	provider := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer provider.Close()
+
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{
+			"issuer":   provider.issuer,
+			"jwks_uri": provider.issuer + "/.well-known/jwks.json",
+		})
+	})
+
+	testCases := []struct {
+		name      string
+		issuer    string
+		opts      []echojwtx.Opts
+		expectErr error
+	}{
+		{
+			"matching issuer",
+			provider.issuer,
+			nil,
+			nil,
+		},
+		{
+			"matching issuer with trailing slash",
+			provider.issuer + "/",
+			nil,
+			nil,
+		},
+		{
+			"tampered discovery issuer",
+			srv.URL,
+			nil,
+			echojwtx.ErrDiscoveryIssuerMismatch,
+		},
+		{
+			"tampered discovery issuer verification disabled",
+			srv.URL,
+			[]echojwtx.Opts{echojwtx.WithVerifyDiscoveryIssuer(false)},
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: tc.issuer,
+			}, tc.opts...)
+
+			assert.ErrorIs(t, err, tc.expectErr, "unexpected NewAuth error")
+		})
+	}
+}
+
+func TestDiscoveryIssuer(t *testing.T) {
+	publicIssuer := "https://idp.example.com/realm"
+
+	provider := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer provider.Close()
+
+	e := echo.New()
+
+	internal := httptest.NewServer(e)
+	defer internal.Close()
+
+	e.GET("/realm/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{
+			"issuer":   publicIssuer,
+			"jwks_uri": provider.issuer + "/.well-known/jwks.json",
+		})
+	})
+
+	_, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: internal.URL + "/realm",
+	})
+
+	assert.ErrorIs(t, err, echojwtx.ErrDiscoveryIssuerMismatch, "expected internal issuer not to match discovery issuer")
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: publicIssuer,
+	}, echojwtx.WithDiscoveryIssuer(internal.URL+"/realm"))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	testCases := []struct {
+		name             string
+		issuer           string
+		expectStatusCode int
+	}{
+		{
+			"public issuer",
+			publicIssuer,
+			http.StatusOK,
+		},
+		{
+			"internal issuer",
+			internal.URL + "/realm",
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := echo.New()
+
+			srv.Use(auth.Middleware())
+
+			srv.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+
+			srv.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+				"iss": tc.issuer,
+				"sub": "urn:test:user",
+			})))
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestStrictDiscoveryContentType(t *testing.T) {
+	provider := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer provider.Close()
+
+	testCases := []struct {
+		name        string
+		contentType string
+		strict      bool
+		expectErr   error
+	}{
+		{
+			"json",
+			"application/json",
+			true,
+			nil,
+		},
+		{
+			"json with charset",
+			"application/json; charset=utf-8",
+			true,
+			nil,
+		},
+		{
+			"html",
+			"text/html",
+			true,
+			echojwtx.ErrDiscoveryContentType,
+		},
+		{
+			"html lenient",
+			"text/html",
+			false,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			srv := httptest.NewServer(e)
+			defer srv.Close()
+
+			e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+				return c.Blob(http.StatusOK, tc.contentType, []byte(`{"issuer":"`+srv.URL+`","jwks_uri":"`+provider.issuer+`/.well-known/jwks.json"}`))
+			})
+
+			_, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: srv.URL,
+			}, echojwtx.WithStrictDiscoveryContentType(tc.strict))
+
+			if tc.expectErr != nil {
+				assert.ErrorIs(t, err, tc.expectErr, "unexpected error for NewAuth")
+
+				return
+			}
+
+			assert.NoError(t, err, "no error expected for NewAuth")
+		})
+	}
+}
+
+func TestDiscoveryHeaders(t *testing.T) {
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	var (
+		keyID   atomic.Value
+		missing atomic.Int32
+	)
+
+	keyID.Store(TestPrivRSAKey2ID)
+
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get("X-Api-Key") != "secret" {
+				missing.Add(1)
+
+				return c.NoContent(http.StatusUnauthorized)
+			}
+
+			return next(c)
+		}
+	})
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"issuer": srv.URL, "jwks_uri": srv.URL + "/jwks.json"})
+	})
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, testHelperJoseJWKSProvider(keyID.Load().(string)))
+	})
+
+	_, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	})
+
+	require.Error(t, err, "expected error without discovery headers")
+
+	missing.Store(0)
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	}, echojwtx.WithDiscoveryHeaders(http.Header{"X-Api-Key": []string{"secret"}}))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	// rotate the served key so the request refreshes the jwks.
+	keyID.Store(TestPrivRSAKey1ID)
+
+	router := echo.New()
+
+	router.Use(auth.Middleware())
+
+	router.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+		"iss": srv.URL,
+		"sub": "urn:test:user",
+	})))
+
+	assert.Equal(t, http.StatusOK, rec.Code, "expected 200 response after jwks refresh")
+	assert.Zero(t, missing.Load(), "expected headers on every request")
+}
+
+func TestDiscoveryAcceptHeader(t *testing.T) {
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	var accept atomic.Value
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		accept.Store(c.Request().Header.Values(echo.HeaderAccept))
+
+		if c.Request().Header.Get(echo.HeaderAccept) != echo.MIMEApplicationJSON {
+			return c.XMLBlob(http.StatusOK, []byte("<configuration/>"))
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{"issuer": srv.URL, "jwks_uri": srv.URL + "/jwks.json"})
+	})
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, testHelperJoseJWKSProvider(TestPrivRSAKey1ID))
+	})
+
+	_, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	})
+
+	require.NoError(t, err, "no error expected for NewAuth")
+	assert.Equal(t, []string{echo.MIMEApplicationJSON}, accept.Load(), "expected json accept header by default")
+
+	_, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	}, echojwtx.WithDiscoveryHeaders(http.Header{echo.HeaderAccept: []string{"application/xml"}}))
+
+	require.ErrorIs(t, err, echojwtx.ErrDiscoveryContentType, "expected configured accept header to be sent")
+	assert.Equal(t, []string{"application/xml"}, accept.Load(), "expected configured accept header to replace the default")
+}
+
+func TestDiscoveryRefreshInterval(t *testing.T) {
+	previous := newTestOIDCProvider()
+	defer previous.Close()
+
+	current := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer current.Close()
+
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	var jwksURI atomic.Value
+
+	jwksURI.Store(previous.issuer + "/.well-known/jwks.json")
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{
+			"issuer":   srv.URL,
+			"jwks_uri": jwksURI.Load(),
+		})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	auth, err := echojwtx.NewAuth(ctx, echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	}, echojwtx.WithDiscoveryRefreshInterval(10*time.Millisecond))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	router := echo.New()
+
+	router.Use(auth.Middleware())
+
+	router.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	token := testHelperMustSignClaims(map[string]interface{}{
+		"iss": srv.URL,
+		"sub": "urn:test:user",
+	})
+
+	doRequest := func() int {
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, doRequest(), "expected key to be unknown before jwks_uri changes")
+
+	jwksURI.Store(current.issuer + "/.well-known/jwks.json")
+
+	assert.Eventually(t, func() bool {
+		return doRequest() == http.StatusOK
+	}, time.Second, 10*time.Millisecond, "expected key from changed jwks_uri to be used")
+}
+
+func TestFallbackIssuers(t *testing.T) {
+	primary := httptest.NewServer(http.NotFoundHandler())
+	primary.Close()
+
+	backup := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer backup.Close()
+
+	_, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: primary.URL,
+	}, echojwtx.WithFallbackIssuers(primary.URL+"/other"))
+
+	require.Error(t, err, "expected error when no issuer is discovered")
+	assert.Contains(t, err.Error(), primary.URL+":", "expected error for primary issuer")
+	assert.Contains(t, err.Error(), primary.URL+"/other:", "expected error for fallback issuer")
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: primary.URL,
+	}, echojwtx.WithFallbackIssuers(backup.issuer))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	testCases := []struct {
+		name             string
+		issuer           string
+		expectStatusCode int
+	}{
+		{
+			"primary issuer",
+			primary.URL,
+			http.StatusOK,
+		},
+		{
+			"fallback issuer",
+			backup.issuer,
+			http.StatusOK,
+		},
+		{
+			"unknown issuer",
+			"https://unknown.example.com",
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+				"iss": tc.issuer,
+				"sub": "urn:test:user",
+			})))
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestPublicKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "no error expected generating ec key")
+
+	unknownKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "no error expected generating ec key")
+
+	issuer := "https://issuer.example.com"
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+
+		raw, err := token.SignedString(key)
+		require.NoError(t, err, "no error expected signing token")
+
+		return raw
+	}
+
+	claims := jwt.MapClaims{"iss": issuer, "sub": "urn:test:user"}
+
+	testCases := []struct {
+		name             string
+		token            string
+		expectStatusCode int
+	}{
+		{
+			"rsa key",
+			sign(jwt.SigningMethodRS256, TestPrivRSAKey1ID, TestPrivRSAKey1, claims),
+			http.StatusOK,
+		},
+		{
+			"ec key",
+			sign(jwt.SigningMethodES256, "ec", ecKey, claims),
+			http.StatusOK,
+		},
+		{
+			"unknown kid",
+			sign(jwt.SigningMethodES256, "unknown", unknownKey, claims),
+			http.StatusUnauthorized,
+		},
+		{
+			"key for another kid",
+			sign(jwt.SigningMethodES256, "ec", unknownKey, claims),
+			http.StatusUnauthorized,
+		},
+		{
+			"invalid issuer",
+			sign(jwt.SigningMethodES256, "ec", ecKey, jwt.MapClaims{"iss": "https://other.example.com", "sub": "urn:test:user"}),
+			http.StatusUnauthorized,
+		},
+	}
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithPublicKeys(map[string]crypto.PublicKey{
+		TestPrivRSAKey1ID: &TestPrivRSAKey1.PublicKey,
+		"ec":              &ecKey.PublicKey,
+	}))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.Equal(t, echojwtx.KeySourceStaticKeys, auth.KeySource(), "expected discovery to be skipped")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", tc.token))
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func ExampleWithKeyfunc() {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	key, err := authtest.NewOfflineKey("offline", privateKey)
+	if err != nil {
+		panic(err)
+	}
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: "https://issuer.example.com",
+	}, echojwtx.WithKeyfunc(key.Keyfunc))
+	if err != nil {
+		panic(err)
+	}
+
+	token, err := key.Sign(jwt.MapClaims{
+		"iss": "https://issuer.example.com",
+		"sub": "urn:test:user",
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/whoami", func(c echo.Context) error {
+		return c.String(http.StatusOK, echojwtx.Actor(c))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	fmt.Println(rec.Code, rec.Body.String())
+	// Output: 200 urn:test:user
+}
+
+func ExampleWithIssuerHTTPClient_unixSocket() {
+	dir, err := os.MkdirTemp("", "echojwtx")
+	if err != nil {
+		panic(err)
+	}
+
+	defer os.RemoveAll(dir) //nolint:errcheck // cleanup
+
+	socket := filepath.Join(dir, "agent.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		panic(err)
+	}
+
+	// the local agent serves discovery and the JWKS over the socket.
+	agent := echo.New()
+
+	agent.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"issuer": "http://unix", "jwks_uri": "http://unix/jwks"})
+	})
+
+	agent.GET("/jwks", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, testHelperJoseJWKSProvider(TestPrivRSAKey1ID))
+	})
+
+	srv := &http.Server{Handler: agent} //nolint:gosec // example server
+
+	go srv.Serve(listener) //nolint:errcheck // closed below
+
+	defer srv.Close() //nolint:errcheck // cleanup
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: "http://unix",
+	}, echojwtx.WithIssuerHTTPClient("http://unix", client))
+	if err != nil {
+		panic(err)
+	}
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/whoami", func(c echo.Context) error {
+		return c.String(http.StatusOK, echojwtx.Actor(c))
+	})
+
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/whoami", testHelperMustSignClaims(map[string]interface{}{
+		"iss": "http://unix",
+		"sub": "urn:test:user",
+	})))
+
+	fmt.Println(rec.Code, rec.Body.String())
+	// Output: 200 urn:test:user
+}
+
+func TestWrapJWTConfig(t *testing.T) {
+	_, err := echojwtx.WrapJWTConfig(echojwt.Config{}, "https://issuer.example.com", "api")
+
+	require.ErrorIs(t, err, echojwtx.ErrKeyfuncRequired, "expected error without keyfunc")
+
+	issuer := "https://issuer.example.com"
+
+	auth, err := echojwtx.WrapJWTConfig(echojwt.Config{
+		TokenLookup: "header:X-Token",
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/health"
+		},
+		KeyFunc: func(*jwt.Token) (interface{}, error) {
+			return &TestPrivRSAKey1.PublicKey, nil
+		},
+	}, issuer, "api")
+
+	require.NoError(t, err, "no error expected for WrapJWTConfig")
+	assert.Equal(t, echojwtx.KeySourceInjectedKeyfunc, auth.KeySource(), "expected discovery to be skipped")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.String(http.StatusOK, echojwtx.Actor(c))
+	})
+
+	e.GET("/health", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	testCases := []struct {
+		name             string
+		path             string
+		header           string
+		token            string
+		expectStatusCode int
+		expectBody       string
+	}{
+		{
+			"token in configured header",
+			"/test",
+			"X-Token",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "aud": "api", "sub": "urn:test:user"}),
+			http.StatusOK,
+			"urn:test:user",
+		},
+		{
+			"token in authorization header",
+			"/test",
+			echo.HeaderAuthorization,
+			"Bearer " + testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "aud": "api", "sub": "urn:test:user"}),
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"invalid issuer",
+			"/test",
+			"X-Token",
+			testHelperMustSignClaims(map[string]interface{}{"iss": "https://other.example.com", "aud": "api", "sub": "urn:test:user"}),
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"invalid audience",
+			"/test",
+			"X-Token",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "aud": "other", "sub": "urn:test:user"}),
+			http.StatusUnauthorized,
+			"",
+		},
+		{
+			"skipped",
+			"/health",
+			"",
+			"",
+			http.StatusOK,
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.token)
+			}
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectStatusCode, rec.Code, "unexpected status code")
+
+			if tc.expectBody != "" {
+				assert.Equal(t, tc.expectBody, rec.Body.String(), "unexpected actor")
+			}
+		})
+	}
+}
+
+func TestWrapJWTConfigContextKey(t *testing.T) {
+	issuer := "https://issuer.example.com"
+
+	auth, err := echojwtx.WrapJWTConfig(echojwt.Config{
+		ContextKey: "token",
+		KeyFunc: func(*jwt.Token) (interface{}, error) {
+			return &TestPrivRSAKey1.PublicKey, nil
+		},
+	}, issuer, "api")
+
+	require.NoError(t, err, "no error expected for WrapJWTConfig")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.String(http.StatusOK, echojwtx.Actor(c))
+	})
+
+	doRequest := func(claims map[string]interface{}) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(claims)))
+
+		return rec
+	}
+
+	rec := doRequest(map[string]interface{}{"iss": issuer, "aud": "api", "sub": "urn:test:user"})
+
+	assert.Equal(t, http.StatusOK, rec.Code, "expected 200 response from test server")
+	assert.Equal(t, "urn:test:user", rec.Body.String(), "expected actor from token under the configured context key")
+
+	rec = doRequest(map[string]interface{}{"iss": "https://other.example.com", "aud": "api", "sub": "urn:test:user"})
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "expected wrong issuer to be rejected")
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for requests to the issuer while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("issuer circuit breaker is open")
+
+// WithCircuitBreaker stops making discovery and JWKS requests to the issuer for the cooldown after threshold
+// consecutive requests fail, either with a transport error or a 5xx response. While open, tokens which would
+// refresh the JWKS are rejected with a 503 immediately instead of waiting on a failing issuer. Once the cooldown
+// passes requests are attempted again, a success closes the breaker while a failure keeps it open for another
+// cooldown. The breaker uses the clock configured with WithClock.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Opts {
+	return func(a *Auth) {
+		a.breaker = &circuitBreaker{
+			threshold: threshold,
+			cooldown:  cooldown,
+		}
+	}
+}
+
+// circuitBreaker tracks consecutive failures of issuer requests. A nil circuitBreaker always allows requests.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+// allow returns true if requests may be made to the issuer.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.failures < b.threshold || !b.now().Before(b.openedAt.Add(b.cooldown))
+}
+
+// record records the outcome of a request to the issuer, opening the breaker once the threshold is reached.
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.failures = 0
+
+		return
+	}
+
+	b.failures++
+
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
+
+// fork returns a new breaker with the same threshold, cooldown and clock which tracks failures independently.
+func (b *circuitBreaker) fork() *circuitBreaker {
+	if b == nil {
+		return nil
+	}
+
+	return &circuitBreaker{
+		threshold: b.threshold,
+		cooldown:  b.cooldown,
+		now:       b.now,
+	}
+}
+
+// client returns a copy of the provided client whose requests go through the breaker.
+func (b *circuitBreaker) client(client *http.Client) *http.Client {
+	if b == nil {
+		return client
+	}
+
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	wrapped := *client
+	wrapped.Transport = &breakerTransport{
+		breaker: b,
+		next:    next,
+	}
+
+	return &wrapped
+}
+
+// breakerTransport is a http.RoundTripper failing fast with ErrCircuitOpen while the breaker is open.
+type breakerTransport struct {
+	breaker *circuitBreaker
+	next    http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	res, err := t.next.RoundTrip(req)
+
+	t.breaker.record(err != nil || res.StatusCode >= http.StatusInternalServerError)
+
+	return res, err
+}
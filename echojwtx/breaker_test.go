@@ -0,0 +1,104 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	var (
+		failing  atomic.Bool
+		keyID    atomic.Value
+		requests atomic.Int32
+	)
+
+	keyID.Store(TestPrivRSAKey2ID)
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"issuer": srv.URL, "jwks_uri": srv.URL + "/jwks.json"})
+	})
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		requests.Add(1)
+
+		if failing.Load() {
+			return c.NoContent(http.StatusInternalServerError)
+		}
+
+		return c.JSON(http.StatusOK, testHelperJoseJWKSProvider(keyID.Load().(string)))
+	})
+
+	var now atomic.Value
+
+	now.Store(time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	auth, err := echojwtx.NewAuth(ctx, echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	},
+		echojwtx.WithCircuitBreaker(2, time.Minute),
+		echojwtx.WithClock(func() time.Time { return now.Load().(time.Time) }),
+		echojwtx.WithKeyFuncOptions(keyfunc.Options{RefreshRateLimit: time.Nanosecond}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	router := echo.New()
+
+	router.Use(auth.Middleware())
+
+	router.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	// the token's key is not in the served jwks, so every request refreshes the jwks.
+	token := testHelperMustSignClaims(map[string]interface{}{
+		"iss": srv.URL,
+		"sub": "urn:test:user",
+	})
+
+	doRequest := func() int {
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+		return rec.Code
+	}
+
+	failing.Store(true)
+
+	assert.Equal(t, http.StatusUnauthorized, doRequest(), "expected unknown key before breaker trips")
+	assert.Equal(t, http.StatusUnauthorized, doRequest(), "expected unknown key before breaker trips")
+
+	tripped := requests.Load()
+
+	assert.Equal(t, http.StatusServiceUnavailable, doRequest(), "expected open breaker to fail fast")
+	assert.Equal(t, tripped, requests.Load(), "expected no jwks requests while breaker is open")
+
+	failing.Store(false)
+	keyID.Store(TestPrivRSAKey1ID)
+
+	assert.Equal(t, http.StatusServiceUnavailable, doRequest(), "expected breaker to stay open during cooldown")
+
+	now.Store(now.Load().(time.Time).Add(time.Minute))
+
+	assert.Equal(t, http.StatusOK, doRequest(), "expected breaker to reset after cooldown")
+}
@@ -0,0 +1,162 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// maxTokenCacheSize limits the number of tokens held by the validation cache.
+const maxTokenCacheSize = 10000
+
+// ErrTokenCacheDisabled is returned by WarmCache when the validation cache is not enabled.
+var ErrTokenCacheDisabled = errors.New("token validation cache is not enabled")
+
+// WithTokenCache enables caching tokens which passed signature and registered claim validation for up to ttl, or
+// until they expire if sooner. Cached tokens skip parsing and key resolution, while the remaining validation, such
+// as the audience and issuer checks, still runs on every request.
+//
+// A cached token continues to be accepted for the ttl after its key is removed from the JWKS, so the ttl should be
+// kept short. Tokens are only cached when the JWTConfig has no ParseTokenFunc or NewClaimsFunc.
+func WithTokenCache(ttl time.Duration) Opts {
+	return func(a *Auth) {
+		a.tokenCache = &tokenCache{
+			ttl:     ttl,
+			entries: make(map[[sha256.Size]byte]tokenCacheEntry),
+		}
+	}
+}
+
+// tokenCacheEntry is a cached token and the time it must be validated again.
+type tokenCacheEntry struct {
+	token   *jwt.Token
+	expires time.Time
+}
+
+// tokenCache caches validated tokens by the hash of the raw token. A nil tokenCache caches nothing.
+type tokenCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]tokenCacheEntry
+}
+
+// get returns the cached token for the raw token if it has not expired.
+func (tc *tokenCache) get(raw string, now time.Time) (*jwt.Token, bool) {
+	if tc == nil {
+		return nil, false
+	}
+
+	key := sha256.Sum256([]byte(raw))
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	entry, ok := tc.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if !now.Before(entry.expires) {
+		delete(tc.entries, key)
+
+		return nil, false
+	}
+
+	return entry.token, true
+}
+
+// add caches the token for the raw token until the ttl elapses or the token expires.
+// Expired entries are removed when the cache is full, and the token isn't cached if the cache is still full.
+func (tc *tokenCache) add(raw string, token *jwt.Token, now time.Time) {
+	if tc == nil {
+		return
+	}
+
+	expires := now.Add(tc.ttl)
+
+	if exp, err := token.Claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(expires) {
+		expires = exp.Time
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if len(tc.entries) >= maxTokenCacheSize {
+		for key, entry := range tc.entries {
+			if !now.Before(entry.expires) {
+				delete(tc.entries, key)
+			}
+		}
+
+		if len(tc.entries) >= maxTokenCacheSize {
+			return
+		}
+	}
+
+	tc.entries[sha256.Sum256([]byte(raw))] = tokenCacheEntry{
+		token:   token,
+		expires: expires,
+	}
+}
+
+// WarmCache validates the provided tokens and adds the valid tokens to the validation cache, avoiding the cost of
+// validating known tokens, such as service tokens, on their first request. All tokens are processed and the
+// errors for the tokens which failed validation are returned joined, identified by their index.
+// ErrTokenCacheDisabled is returned if WithTokenCache was not set or tokens are not cached as the JWTConfig has a
+// ParseTokenFunc or NewClaimsFunc.
+func (a *Auth) WarmCache(ctx context.Context, tokens ...string) error {
+	if a.tokenCache == nil || a.parseTokenFunc != nil || a.JWTConfig.NewClaimsFunc != nil {
+		return ErrTokenCacheDisabled
+	}
+
+	var errs []error
+
+	for i, raw := range tokens {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+
+		if err := a.warmToken(raw); err != nil {
+			errs = append(errs, fmt.Errorf("token %d: %w", i, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// warmToken validates the raw token and adds it to the validation cache.
+func (a *Auth) warmToken(raw string) error {
+	raw, err := a.prepareToken(a.logger, raw)
+	if err != nil {
+		return err
+	}
+
+	token, err := a.verifyToken(raw, jwt.MapClaims{}, 0)
+	if err != nil {
+		return err
+	}
+
+	a.tokenCache.add(raw, token, a.now())
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestWarmCache(t *testing.T) {
+	var keyLookups atomic.Int32
+
+	keyFunc := func(*jwt.Token) (interface{}, error) {
+		keyLookups.Add(1)
+
+		return &TestPrivRSAKey1.PublicKey, nil
+	}
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: "https://issuer.example.com",
+		},
+		echojwtx.WithJWTConfig(echojwt.Config{KeyFunc: keyFunc}),
+		echojwtx.WithTokenCache(time.Minute),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	token := testHelperMustSignClaims(map[string]interface{}{
+		"iss": "https://issuer.example.com",
+		"sub": "urn:test:user",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	err = auth.WarmCache(context.Background(), token, "not-a-token")
+
+	require.Error(t, err, "expected error for invalid token")
+	assert.Contains(t, err.Error(), "token 1:", "expected error to identify invalid token")
+	assert.NotContains(t, err.Error(), "token 0:", "expected no error for valid token")
+	assert.Equal(t, int32(1), keyLookups.Load(), "expected key lookup while warming")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+		assert.Equal(t, http.StatusOK, rec.Code, "expected 200 response from test server")
+	}
+
+	assert.Equal(t, int32(1), keyLookups.Load(), "expected cached token to skip key lookup")
+
+	uncached, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: "https://issuer.example.com",
+		},
+		echojwtx.WithJWTConfig(echojwt.Config{KeyFunc: keyFunc}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.ErrorIs(t, uncached.WarmCache(context.Background(), token), echojwtx.ErrTokenCacheDisabled, "expected cache disabled error")
+}
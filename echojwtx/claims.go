@@ -0,0 +1,121 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var errInvalidClaimType = errors.New("invalid claim type")
+
+// claimAtPath returns the claim value found at the provided dotted path.
+// For example the path "resource_access.client.audience" will traverse nested claim objects.
+func claimAtPath(claims jwt.MapClaims, path string) (interface{}, bool) {
+	var value interface{} = map[string]interface{}(claims)
+
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if value, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// claimStrings converts a claim value which may be a string or an array of strings into a string slice.
+func claimStrings(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		values := make([]string, len(v))
+
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, errInvalidClaimType
+			}
+
+			values[i] = s
+		}
+
+		return values, nil
+	default:
+		return nil, errInvalidClaimType
+	}
+}
+
+// claimString formats a claim value as a string.
+// Array values are joined with a comma, numbers are formatted without an exponent.
+func claimString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case []interface{}:
+		values := make([]string, len(v))
+
+		for i, item := range v {
+			values[i] = claimString(item)
+		}
+
+		return strings.Join(values, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// claimScopes returns the scopes granted to the token.
+// The scope claim split on sep is used if present, otherwise the scp claim which may be a string or an array.
+// An empty sep splits the scope claim on whitespace.
+func claimScopes(claims jwt.MapClaims, sep string) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		if sep == "" {
+			return strings.Fields(scope)
+		}
+
+		var scopes []string
+
+		for _, s := range strings.Split(scope, sep) {
+			if s = strings.TrimSpace(s); s != "" {
+				scopes = append(scopes, s)
+			}
+		}
+
+		return scopes
+	}
+
+	scopes, _ := claimStrings(claims["scp"])
+
+	return scopes
+}
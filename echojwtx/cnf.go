@@ -0,0 +1,80 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	errCertificateRequired   = errors.New("client certificate required for bound token")
+	errCertificateThumbprint = errors.New("client certificate does not match token binding")
+)
+
+// WithCertificateBinding enables validation of certificate-bound access tokens as defined by RFC 8705.
+// The cnf claim's x5t#S256 thumbprint is compared against the SHA-256 thumbprint of the TLS client certificate
+// of the request. Tokens without a cnf claim, requests without a client certificate and mismatched thumbprints
+// are rejected with a 401.
+//
+// The client certificate is read from the request's TLS connection state, so the server must terminate TLS and
+// request client certificates, for example by setting tls.Config ClientAuth to tls.RequireAndVerifyClientCert
+// (or tls.VerifyClientCertIfGiven) with the trusted client CAs in ClientCAs. Deployments terminating TLS at a
+// proxy are not supported as the client certificate is not available to the server.
+func WithCertificateBinding() Opts {
+	return func(a *Auth) {
+		a.certificateBinding = true
+	}
+}
+
+// certificateThumbprint returns the base64url encoded SHA-256 thumbprint of the DER encoded certificate.
+func certificateThumbprint(der []byte) string {
+	sum := sha256.Sum256(der)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// validateCertificateBinding validates the token's cnf claim against the request's client certificate if enabled.
+func (a *Auth) validateCertificateBinding(c echo.Context, claims jwt.MapClaims) error {
+	if !a.certificateBinding {
+		return nil
+	}
+
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	thumbprint, _ := cnf["x5t#S256"].(string)
+
+	if thumbprint == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errCertificateThumbprint)
+	}
+
+	state := c.Request().TLS
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errCertificateRequired)
+	}
+
+	expected := certificateThumbprint(state.PeerCertificates[0].Raw)
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(thumbprint)) != 1 {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errCertificateThumbprint)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package echojwtx_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestCertificateBinding(t *testing.T) {
+	clientCert := &x509.Certificate{Raw: []byte("test-client-certificate")}
+	otherCert := &x509.Certificate{Raw: []byte("other-client-certificate")}
+
+	sum := sha256.Sum256(clientCert.Raw)
+	thumbprint := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	testCases := []struct {
+		name             string
+		cnf              interface{}
+		cert             *x509.Certificate
+		expectStatusCode int
+	}{
+		{
+			"matching certificate",
+			map[string]interface{}{"x5t#S256": thumbprint},
+			clientCert,
+			http.StatusOK,
+		},
+		{
+			"mismatched certificate",
+			map[string]interface{}{"x5t#S256": thumbprint},
+			otherCert,
+			http.StatusUnauthorized,
+		},
+		{
+			"missing certificate",
+			map[string]interface{}{"x5t#S256": thumbprint},
+			nil,
+			http.StatusUnauthorized,
+		},
+		{
+			"missing cnf",
+			nil,
+			clientCert,
+			http.StatusUnauthorized,
+		},
+	}
+
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: issuer,
+		},
+		echojwtx.WithCertificateBinding(),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := map[string]interface{}{
+				"iss": issuer,
+				"sub": "urn:test:user",
+			}
+
+			if tc.cnf != nil {
+				claims["cnf"] = tc.cnf
+			}
+
+			req := testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(claims))
+
+			if tc.cert != nil {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tc.cert}}
+			}
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
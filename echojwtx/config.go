@@ -0,0 +1,227 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/spf13/viper"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	// ErrInvalidAuthConfig is returned by LoadAuthConfig when the loaded configuration is not valid.
+	ErrInvalidAuthConfig = errors.New("invalid auth config")
+
+	// ErrEnvironmentVariableUnset is returned when a configuration references an environment variable which is
+	// not set.
+	ErrEnvironmentVariableUnset = errors.New("environment variable not set")
+)
+
+// fileConfig is the structure of an auth configuration file.
+type fileConfig struct {
+	AuthConfig `mapstructure:",squash"`
+
+	// TokenLookup is the echojwt TokenLookup, such as "header:Authorization:Bearer ".
+	TokenLookup string `mapstructure:"token_lookup"`
+
+	// ClockSkew is the leeway allowed when validating the exp and nbf claims.
+	ClockSkew time.Duration `mapstructure:"clock_skew"`
+
+	// Scopes are the scopes required for all requests.
+	Scopes []string `mapstructure:"scopes"`
+
+	// AdditionalJWKSURIs are JWKS uris loaded in addition to the issuer's jwks_uri.
+	AdditionalJWKSURIs []string `mapstructure:"additional_jwks_uris"`
+}
+
+// LoadAuthConfig reads the AuthConfig and options derived from a JSON or YAML file. The format is selected by
+// the file extension, .json, .yaml or .yml. Environment variables in the string values of the file are expanded,
+// using either the $VAR or ${VAR} syntax, after it is parsed, so variables in keys and comments are left as is
+// and a variable's value is never parsed as part of the file. ErrEnvironmentVariableUnset is returned if a
+// referenced variable is not set, while variables set to an empty value expand to an empty string.
+//
+// The file uses the AuthConfig mapstructure keys along with token_lookup, clock_skew, scopes and
+// additional_jwks_uris to derive the matching options:
+//
+//	issuer: https://${IDP_HOST}/realm
+//	audience: my-service
+//	refresh_timeout: 5s
+//	token_lookup: "header:Authorization:Bearer "
+//	clock_skew: 30s
+//	scopes: [read, write]
+//
+// Setting token_lookup returns a WithJWTConfig option, so a WithJWTConfig option passed to NewAuth after the
+// loaded options replaces it. ErrInvalidAuthConfig is returned if the issuer is missing or not a url, or if a
+// duration is negative.
+func LoadAuthConfig(path string) (AuthConfig, []Opts, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return AuthConfig{}, nil, err
+	}
+
+	v := viper.New()
+
+	v.SetConfigType(strings.TrimPrefix(filepath.Ext(path), "."))
+
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return AuthConfig{}, nil, err
+	}
+
+	if err := expandConfigEnv(v); err != nil {
+		return AuthConfig{}, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var cfg fileConfig
+
+	if err := v.Unmarshal(&cfg); err != nil {
+		return AuthConfig{}, nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return AuthConfig{}, nil, err
+	}
+
+	var opts []Opts
+
+	if cfg.TokenLookup != "" {
+		opts = append(opts, WithJWTConfig(echojwt.Config{TokenLookup: cfg.TokenLookup}))
+	}
+
+	if cfg.ClockSkew > 0 {
+		opts = append(opts, WithClockSkew(cfg.ClockSkew))
+	}
+
+	if len(cfg.Scopes) != 0 {
+		opts = append(opts, WithRequiredScopes(cfg.Scopes...))
+	}
+
+	if len(cfg.AdditionalJWKSURIs) != 0 {
+		opts = append(opts, WithAdditionalJWKSURIs(cfg.Issuer, cfg.AdditionalJWKSURIs...))
+	}
+
+	return cfg.AuthConfig, opts, nil
+}
+
+// ExpandAuthConfig expands environment variable references in the issuer and audience of the config, using
+// either the $VAR or ${VAR} syntax, such as an issuer of https://${ENV}.idp.example.com/realm read from flags.
+// ErrEnvironmentVariableUnset is returned if a referenced variable is not set.
+func ExpandAuthConfig(config AuthConfig) (AuthConfig, error) {
+	issuer, err := expandEnv(config.Issuer)
+	if err != nil {
+		return AuthConfig{}, fmt.Errorf("issuer: %w", err)
+	}
+
+	audience, err := expandEnv(config.Audience)
+	if err != nil {
+		return AuthConfig{}, fmt.Errorf("audience: %w", err)
+	}
+
+	config.Issuer = issuer
+	config.Audience = audience
+
+	return config, nil
+}
+
+// expandEnv expands environment variable references in s, returning an error naming every referenced variable
+// which is not set.
+func expandEnv(s string) (string, error) {
+	var unset []string
+
+	expanded := expandEnvUnset(s, &unset)
+
+	if len(unset) != 0 {
+		return "", unsetEnvError(unset)
+	}
+
+	return expanded, nil
+}
+
+// expandConfigEnv expands environment variable references in the string values of the parsed configuration,
+// including strings in lists, returning an error naming every referenced variable which is not set.
+func expandConfigEnv(v *viper.Viper) error {
+	var unset []string
+
+	keys := v.AllKeys()
+
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		switch value := v.Get(key).(type) {
+		case string:
+			v.Set(key, expandEnvUnset(value, &unset))
+		case []interface{}:
+			for i, item := range value {
+				if s, ok := item.(string); ok {
+					value[i] = expandEnvUnset(s, &unset)
+				}
+			}
+
+			v.Set(key, value)
+		}
+	}
+
+	if len(unset) != 0 {
+		return unsetEnvError(unset)
+	}
+
+	return nil
+}
+
+// expandEnvUnset expands environment variable references in s, adding the variables which are not set to unset.
+func expandEnvUnset(s string, unset *[]string) string {
+	return os.Expand(s, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok && !slices.Contains(*unset, name) {
+			*unset = append(*unset, name)
+		}
+
+		return value
+	})
+}
+
+// unsetEnvError returns ErrEnvironmentVariableUnset naming the unset variables.
+func unsetEnvError(unset []string) error {
+	return fmt.Errorf("%w: %s", ErrEnvironmentVariableUnset, strings.Join(unset, ", "))
+}
+
+// validate validates the loaded configuration.
+func (cfg fileConfig) validate() error {
+	if cfg.Issuer == "" {
+		return fmt.Errorf("%w: issuer is required", ErrInvalidAuthConfig)
+	}
+
+	if uri, err := url.Parse(cfg.Issuer); err != nil || uri.Scheme == "" || uri.Host == "" {
+		return fmt.Errorf("%w: issuer %q is not a url", ErrInvalidAuthConfig, cfg.Issuer)
+	}
+
+	if cfg.RefreshTimeout < 0 {
+		return fmt.Errorf("%w: refresh_timeout must not be negative", ErrInvalidAuthConfig)
+	}
+
+	if cfg.ClockSkew < 0 {
+		return fmt.Errorf("%w: clock_skew must not be negative", ErrInvalidAuthConfig)
+	}
+
+	return nil
+}
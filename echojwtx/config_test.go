@@ -0,0 +1,164 @@
+package echojwtx_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestLoadAuthConfig(t *testing.T) {
+	t.Setenv("TEST_IDP_HOST", "idp.example.com")
+	t.Setenv("TEST_IDP_AUDIENCE", "testaud\nissuer: https://other.example.com")
+
+	testCases := []struct {
+		name         string
+		file         string
+		content      string
+		expectConfig echojwtx.AuthConfig
+		expectOpts   int
+		expectErr    error
+	}{
+		{
+			"yaml",
+			"auth.yaml",
+			`
+issuer: https://${TEST_IDP_HOST}/realm
+audience: testaud
+refresh_timeout: 10s
+token_lookup: "header:Authorization:Bearer "
+clock_skew: 30s
+scopes: [read, write]
+`,
+			echojwtx.AuthConfig{
+				Issuer:         "https://idp.example.com/realm",
+				Audience:       "testaud",
+				RefreshTimeout: 10 * time.Second,
+			},
+			3,
+			nil,
+		},
+		{
+			"json",
+			"auth.json",
+			`{"issuer": "https://$TEST_IDP_HOST", "additional_jwks_uris": ["https://keys.example.com/jwks.json"]}`,
+			echojwtx.AuthConfig{
+				Issuer: "https://idp.example.com",
+			},
+			1,
+			nil,
+		},
+		{
+			"unset variable",
+			"auth.yaml",
+			`issuer: https://${TEST_IDP_UNSET_HOST}/realm`,
+			echojwtx.AuthConfig{},
+			0,
+			echojwtx.ErrEnvironmentVariableUnset,
+		},
+		{
+			"variables in comments",
+			"auth.yaml",
+			`
+# previously https://${TEST_IDP_UNSET_HOST}/realm
+issuer: https://${TEST_IDP_HOST}/realm
+`,
+			echojwtx.AuthConfig{
+				Issuer: "https://idp.example.com/realm",
+			},
+			0,
+			nil,
+		},
+		{
+			"variable values not parsed",
+			"auth.yaml",
+			`
+issuer: https://${TEST_IDP_HOST}/realm
+audience: ${TEST_IDP_AUDIENCE}
+`,
+			echojwtx.AuthConfig{
+				Issuer:   "https://idp.example.com/realm",
+				Audience: "testaud\nissuer: https://other.example.com",
+			},
+			0,
+			nil,
+		},
+		{
+			"unset variable in list",
+			"auth.yaml",
+			`
+issuer: https://${TEST_IDP_HOST}/realm
+scopes: [read, "${TEST_IDP_UNSET_SCOPE}"]
+`,
+			echojwtx.AuthConfig{},
+			0,
+			echojwtx.ErrEnvironmentVariableUnset,
+		},
+		{
+			"missing issuer",
+			"auth.yaml",
+			`audience: testaud`,
+			echojwtx.AuthConfig{},
+			0,
+			echojwtx.ErrInvalidAuthConfig,
+		},
+		{
+			"invalid issuer",
+			"auth.yaml",
+			`issuer: not-a-url`,
+			echojwtx.AuthConfig{},
+			0,
+			echojwtx.ErrInvalidAuthConfig,
+		},
+		{
+			"negative clock skew",
+			"auth.yaml",
+			`
+issuer: https://idp.example.com
+clock_skew: -1s
+`,
+			echojwtx.AuthConfig{},
+			0,
+			echojwtx.ErrInvalidAuthConfig,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o600), "no error expected writing config")
+
+			config, opts, err := echojwtx.LoadAuthConfig(path)
+
+			assert.ErrorIs(t, err, tc.expectErr, "unexpected error")
+			assert.Equal(t, tc.expectConfig, config, "unexpected config")
+			assert.Len(t, opts, tc.expectOpts, "unexpected number of options")
+		})
+	}
+
+	_, _, err := echojwtx.LoadAuthConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist, "expected missing file error")
+}
+
+func TestExpandAuthConfig(t *testing.T) {
+	t.Setenv("TEST_IDP_ENV", "staging")
+
+	config, err := echojwtx.ExpandAuthConfig(echojwtx.AuthConfig{
+		Issuer:   "https://${TEST_IDP_ENV}.idp.example.com/realm",
+		Audience: "$TEST_IDP_ENV-api",
+	})
+	require.NoError(t, err, "no error expected expanding config")
+
+	assert.Equal(t, "https://staging.idp.example.com/realm", config.Issuer, "unexpected issuer")
+	assert.Equal(t, "staging-api", config.Audience, "unexpected audience")
+
+	_, err = echojwtx.ExpandAuthConfig(echojwtx.AuthConfig{Issuer: "https://${TEST_IDP_UNSET_ENV}.idp.example.com"})
+	assert.ErrorIs(t, err, echojwtx.ErrEnvironmentVariableUnset, "expected unset variable error")
+	assert.ErrorContains(t, err, "TEST_IDP_UNSET_ENV", "expected error to name the variable")
+}
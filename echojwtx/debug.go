@@ -0,0 +1,70 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// ErrDebugRoutesDisabled is returned by MountDebugRoutes when debug routes were not enabled with WithDebugRoutes.
+var ErrDebugRoutesDisabled = errors.New("debug routes are not enabled")
+
+// debugWhoami is the response of the debug whoami route.
+type debugWhoami struct {
+	Actor  string        `json:"actor"`
+	Claims jwt.MapClaims `json:"claims"`
+}
+
+// WithDebugRoutes allows MountDebugRoutes to register the debug routes, which expose the claims of the
+// authenticated token. This should only be enabled in development, for example from a flag which is never set
+// in production.
+func WithDebugRoutes(enabled bool) Opts {
+	return func(a *Auth) {
+		a.debugRoutes = enabled
+	}
+}
+
+// MountDebugRoutes registers a GET prefix/debug/whoami route, protected by the auth middleware, which responds
+// with the actor and validated claims of the request's token as json. The raw token is never included.
+// ErrDebugRoutesDisabled is returned unless debug routes were enabled with WithDebugRoutes.
+func (a *Auth) MountDebugRoutes(e *echo.Echo, prefix string) error {
+	if a == nil || !a.debugRoutes {
+		return ErrDebugRoutesDisabled
+	}
+
+	a.logger.Warn("jwt debug routes mounted, do not enable in production", zap.String("prefix", prefix))
+
+	e.Group(prefix, a.Middleware()).GET("/debug/whoami", a.debugWhoami)
+
+	return nil
+}
+
+// debugWhoami responds with the actor and claims of the authenticated request.
+func (a *Auth) debugWhoami(c echo.Context) error {
+	resp := debugWhoami{
+		Actor: Actor(c),
+	}
+
+	if token, ok := c.Get(a.contextKey()).(*jwt.Token); ok && token != nil {
+		resp.Claims, _ = token.Claims.(jwt.MapClaims)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,66 @@
+package echojwtx_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestMountDebugRoutes(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	})
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.ErrorIs(t, auth.MountDebugRoutes(echo.New(), "/_"), echojwtx.ErrDebugRoutesDisabled, "expected debug routes to be disabled by default")
+
+	auth, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithDebugRoutes(true))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	require.NoError(t, auth.MountDebugRoutes(e, "/_"), "no error expected mounting debug routes")
+
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/_/debug/whoami", ""))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "expected debug route to require authentication")
+
+	token := testHelperMustSignClaims(map[string]interface{}{
+		"iss": issuer,
+		"sub": "urn:test:user",
+	})
+
+	rec = httptest.NewRecorder()
+
+	e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/_/debug/whoami", token))
+
+	require.Equal(t, http.StatusOK, rec.Code, "expected 200 response from debug route")
+
+	var resp struct {
+		Actor  string                 `json:"actor"`
+		Claims map[string]interface{} `json:"claims"`
+	}
+
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), "expected json response")
+
+	assert.Equal(t, "urn:test:user", resp.Actor, "unexpected actor")
+	assert.Equal(t, issuer, resp.Claims["iss"], "unexpected issuer claim")
+	assert.NotContains(t, rec.Body.String(), token, "expected raw token not to be included")
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// maxActorChainDepth limits how many nested act claims are followed.
+const maxActorChainDepth = 32
+
+type actorChainContext struct{}
+
+// actorChain returns the subjects of the token's act claim (RFC 8693), starting with the current actor and
+// followed by each prior actor of a nested act claim. Nested act claims without a string sub end the chain.
+func actorChain(claims jwt.MapClaims) []string {
+	var chain []string
+
+	act, _ := claims["act"].(map[string]interface{})
+
+	for act != nil && len(chain) < maxActorChainDepth {
+		sub, ok := act["sub"].(string)
+		if !ok {
+			break
+		}
+
+		chain = append(chain, sub)
+
+		act, _ = act["act"].(map[string]interface{})
+	}
+
+	return chain
+}
+
+// ActorChain retrieves the delegation chain of the authenticated request from the context, starting with the
+// actor currently acting on behalf of the token subject and followed by any prior actors. The subject itself
+// remains the request actor, see Actor. False is returned if the token has no act claim.
+func ActorChain(ctx context.Context) ([]string, bool) {
+	chain, ok := ctx.Value(actorChainContext{}).([]string)
+
+	return chain, ok
+}
@@ -0,0 +1,92 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestActorChain(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	testCases := []struct {
+		name        string
+		act         interface{}
+		expectChain []string
+	}{
+		{
+			"two hop delegation",
+			map[string]interface{}{
+				"sub": "urn:test:service-b",
+				"act": map[string]interface{}{
+					"sub": "urn:test:service-a",
+				},
+			},
+			[]string{"urn:test:service-b", "urn:test:service-a"},
+		},
+		{
+			"single actor",
+			map[string]interface{}{"sub": "urn:test:service-a"},
+			[]string{"urn:test:service-a"},
+		},
+		{
+			"no act claim",
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			})
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			var (
+				actor string
+				chain []string
+				found bool
+			)
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				actor = echojwtx.Actor(c)
+				chain, found = echojwtx.ActorChain(c.Request().Context())
+
+				return c.NoContent(http.StatusOK)
+			})
+
+			claims := map[string]interface{}{
+				"iss": issuer,
+				"sub": "urn:test:user",
+			}
+
+			if tc.act != nil {
+				claims["act"] = tc.act
+			}
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(claims)))
+
+			require.Equal(t, http.StatusOK, rec.Code, "expected 200 response from test server")
+
+			assert.Equal(t, "urn:test:user", actor, "expected subject to remain the actor")
+			assert.Equal(t, tc.expectChain != nil, found, "unexpected actor chain presence")
+			assert.Equal(t, tc.expectChain, chain, "unexpected actor chain")
+		})
+	}
+}
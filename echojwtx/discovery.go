@@ -0,0 +1,379 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// maxDiscoveryDocumentSize limits the size of the oidc well-known configuration read from the issuer.
+const maxDiscoveryDocumentSize = 1 << 20
+
+var (
+	// ErrJWKSURIInvalid is returned when the jwks_uri field in the issuer's oidc well-known configuration is not a
+	// string.
+	ErrJWKSURIInvalid = errors.New("jwks_uri from oidc provider is not a string")
+
+	// ErrDiscoveryIssuerMismatch is returned when the issuer field in the issuer's oidc well-known configuration
+	// does not match the configured issuer.
+	ErrDiscoveryIssuerMismatch = errors.New("oidc provider issuer does not match configured issuer")
+
+	// ErrDiscoveryContentType is returned when the issuer's oidc well-known configuration is not served with a json
+	// content type.
+	ErrDiscoveryContentType = errors.New("oidc provider configuration content type is not json")
+)
+
+// discoveryDocument holds the fields used from an oidc well-known configuration.
+type discoveryDocument struct {
+	// Issuer is the issuer field, empty if not provided.
+	Issuer string
+
+	// JWKSURI is the jwks_uri field.
+	JWKSURI string
+
+	// SupportedAlgorithms is the id_token_signing_alg_values_supported field, empty if not provided or invalid.
+	SupportedAlgorithms []string
+
+	// ContentType is the content type the document was served with.
+	ContentType string
+}
+
+// WithDiscoveryIssuer sets the issuer url the oidc well-known configuration is fetched from, while tokens are
+// still required to have the issuer from the AuthConfig. This supports split-horizon deployments where the issuer
+// is reached through an internal url, such as a Kubernetes service, but issues tokens with its public url.
+// The jwks_uri from the configuration is used as is, so the issuer must advertise a jwks_uri reachable from the
+// internal network. The configuration's issuer field is still verified against the AuthConfig issuer.
+func WithDiscoveryIssuer(issuer string) Opts {
+	return func(a *Auth) {
+		a.discoveryIssuer = issuer
+	}
+}
+
+// WithVerifyDiscoveryIssuer enables or disables verifying the issuer field of the oidc well-known configuration
+// matches the configured issuer, ignoring the case of the scheme and host and any trailing slash. A mismatch is
+// often a misconfiguration and allows mix-up attacks, where keys for a different issuer are trusted, so NewAuth
+// fails with ErrDiscoveryIssuerMismatch. Configurations without an issuer field are logged as a warning. This is
+// enabled by default.
+func WithVerifyDiscoveryIssuer(enabled bool) Opts {
+	return func(a *Auth) {
+		a.noDiscoveryIssuerCheck = !enabled
+	}
+}
+
+// WithDiscoveryRefreshInterval periodically fetches the oidc well-known configuration of the discovered issuer
+// again, replacing the discovered JWKS when the issuer advertises a new jwks_uri, such as when moving its keys to
+// a new path. This is independent of the JWKS refresh, which only refreshes the keys at the current jwks_uri.
+// Failed refreshes are logged and the current JWKS is kept. Refreshing stops when the KeyFuncOptions context, or
+// the context provided to NewAuth, is canceled.
+func WithDiscoveryRefreshInterval(d time.Duration) Opts {
+	return func(a *Auth) {
+		a.discoveryRefresh = d
+	}
+}
+
+// refreshDiscovery fetches the issuer's oidc well-known configuration every discovery refresh interval, replacing
+// the discovered JWKS of kf when the jwks_uri changes from the provided uri.
+func (a *Auth) refreshDiscovery(ctx context.Context, issuer, uri string, kf *jwksKeyfunc) {
+	ticker := time.NewTicker(a.discoveryRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		doc, err := a.discoverIssuer(ctx, issuer)
+		if err != nil {
+			a.logger.Error("error refreshing oidc discovery", zap.String("issuer", issuer), zap.Error(err))
+			a.recordDiscoveryError(err)
+
+			continue
+		}
+
+		a.clearDiscoveryError()
+
+		if doc.JWKSURI == uri {
+			continue
+		}
+
+		jwks, err := keyfunc.Get(doc.JWKSURI, a.KeyFuncOptions)
+		if err != nil {
+			a.logger.Error("error fetching changed jwks_uri", zap.String("jwks_uri", doc.JWKSURI), zap.Error(err))
+			a.recordInfraError(err)
+
+			continue
+		}
+
+		a.logger.Info("oidc provider jwks_uri changed", zap.String("previous", uri), zap.String("jwks_uri", doc.JWKSURI))
+
+		kf.replacePrimary(jwks).EndBackground()
+
+		uri = doc.JWKSURI
+	}
+}
+
+// WithStrictDiscoveryContentType enables or disables requiring the oidc well-known configuration to be served with
+// a json content type, such as application/json. Misrouted requests often return an html page, which is reported
+// as ErrDiscoveryContentType instead of a json syntax error. Disable this for providers which serve the
+// configuration with another content type. This is enabled by default.
+func WithStrictDiscoveryContentType(enabled bool) Opts {
+	return func(a *Auth) {
+		a.noStrictDiscoveryContentType = !enabled
+	}
+}
+
+// WithDiscoveryHeaders sets headers which are sent with the oidc well-known configuration request and every JWKS
+// request, including background refreshes, such as an api key required by the issuer. An Accept header replaces
+// the application/json Accept header sent with the well-known configuration request by default. A RequestFactory
+// in the KeyFuncOptions is still used, with the headers added to the requests it creates.
+func WithDiscoveryHeaders(header http.Header) Opts {
+	return func(a *Auth) {
+		a.discoveryHeaders = header.Clone()
+	}
+}
+
+// jwksRequestFactory wraps the KeyFuncOptions RequestFactory, or the default factory if not set, adding the
+// configured discovery headers to JWKS requests.
+func (a *Auth) jwksRequestFactory() func(ctx context.Context, url string) (*http.Request, error) {
+	factory := a.KeyFuncOptions.RequestFactory
+
+	return func(ctx context.Context, url string) (*http.Request, error) {
+		var (
+			req *http.Request
+			err error
+		)
+
+		if factory != nil {
+			req, err = factory(ctx, url)
+		} else {
+			req, err = http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		addHeaders(req, a.discoveryHeaders)
+
+		return req, nil
+	}
+}
+
+// addHeaders adds the provided headers to the request.
+func addHeaders(req *http.Request, header http.Header) {
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+}
+
+// discoverIssuers discovers the configured issuer, trying each fallback issuer in order if discovery fails.
+// The discovered issuer is returned with its discovery document.
+func (a *Auth) discoverIssuers(ctx context.Context) (string, discoveryDocument, error) {
+	if len(a.fallbackIssuers) == 0 {
+		doc, err := a.discoverIssuer(ctx, a.issuer)
+
+		return a.issuer, doc, err
+	}
+
+	var errs []error
+
+	for _, issuer := range append([]string{a.issuer}, a.fallbackIssuers...) {
+		doc, err := a.discoverIssuer(ctx, issuer)
+		if err == nil {
+			return issuer, doc, nil
+		}
+
+		a.logger.Warn("oidc provider discovery failed", zap.String("issuer", issuer), zap.Error(err))
+
+		errs = append(errs, fmt.Errorf("%s: %w", issuer, err))
+	}
+
+	return "", discoveryDocument{}, errors.Join(errs...)
+}
+
+// discoverIssuer fetches and verifies the oidc well-known configuration of the provided issuer using the issuer's
+// http client. The configured discovery issuer url is used for the configured issuer if set.
+func (a *Auth) discoverIssuer(ctx context.Context, issuer string) (discoveryDocument, error) {
+	client := jwksClient
+	if a.rootCAClient != nil {
+		client = a.rootCAClient
+	}
+
+	if issuerClient := a.issuerHTTPClients[issuer]; issuerClient != nil {
+		client = issuerClient
+	}
+
+	client = a.breaker.client(client)
+
+	discoveryIssuer := issuer
+	if issuer == a.issuer && a.discoveryIssuer != "" {
+		discoveryIssuer = a.discoveryIssuer
+	}
+
+	doc, err := discover(ctx, client, discoveryIssuer, a.discoveryHeaders, !a.noStrictDiscoveryContentType)
+	if err != nil {
+		return discoveryDocument{}, err
+	}
+
+	if err := a.verifyDiscoveryIssuer(issuer, doc); err != nil {
+		return discoveryDocument{}, err
+	}
+
+	return doc, nil
+}
+
+// verifyDiscoveryIssuer verifies the discovery document's issuer matches the expected issuer if enabled.
+func (a *Auth) verifyDiscoveryIssuer(issuer string, doc discoveryDocument) error {
+	if a.noDiscoveryIssuerCheck {
+		return nil
+	}
+
+	if doc.Issuer == "" {
+		a.logger.Warn("oidc provider configuration missing issuer", zap.String("issuer", issuer))
+
+		return nil
+	}
+
+	if normalizeIssuer(doc.Issuer) != normalizeIssuer(issuer) {
+		a.logger.Error("oidc provider issuer mismatch", zap.String("issuer", issuer), zap.String("discovery.issuer", doc.Issuer))
+
+		return ErrDiscoveryIssuerMismatch
+	}
+
+	return nil
+}
+
+// normalizeIssuer normalizes an issuer url for comparison, lower casing the scheme and host and removing any
+// trailing slash. Values which aren't urls are only stripped of a trailing slash.
+func normalizeIssuer(issuer string) string {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	uri, err := url.Parse(issuer)
+	if err != nil || uri.Scheme == "" || uri.Host == "" {
+		return issuer
+	}
+
+	uri.Scheme = strings.ToLower(uri.Scheme)
+	uri.Host = strings.ToLower(uri.Host)
+
+	return uri.String()
+}
+
+// discover fetches the issuer's oidc well-known configuration, sending the provided headers. If strict is true the
+// configuration must be served with a json content type. The request accepts application/json unless the provided
+// headers set an Accept header, as some issuers otherwise serve another format.
+func discover(ctx context.Context, client *http.Client, issuer string, header http.Header, strict bool) (discoveryDocument, error) {
+	uri, err := url.JoinPath(issuer, ".well-known", "openid-configuration")
+	if err != nil {
+		return discoveryDocument{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return discoveryDocument{}, err
+	}
+
+	if len(header.Values(echo.HeaderAccept)) == 0 {
+		req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	}
+
+	addHeaders(req, header)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return discoveryDocument{}, err
+	}
+	defer res.Body.Close() //nolint:errcheck // no need to check
+
+	contentType := res.Header.Get(echo.HeaderContentType)
+
+	if strict && !jsonContentType(contentType) {
+		return discoveryDocument{}, fmt.Errorf("%w: %q", ErrDiscoveryContentType, contentType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxDiscoveryDocumentSize))
+	if err != nil {
+		return discoveryDocument{}, err
+	}
+
+	doc, err := parseDiscovery(body)
+	if err != nil {
+		return discoveryDocument{}, err
+	}
+
+	doc.ContentType = contentType
+
+	return doc, nil
+}
+
+// jsonContentType returns true if the content type is application/json or a json based type such as
+// application/jwk-set+json. Parameters such as the charset are ignored.
+func jsonContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == echo.MIMEApplicationJSON || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
+// parseDiscovery parses an oidc well-known configuration document.
+func parseDiscovery(data []byte) (discoveryDocument, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return discoveryDocument{}, err
+	}
+
+	jwksURL, ok := m["jwks_uri"]
+	if !ok || jwksURL == nil {
+		return discoveryDocument{}, ErrJWKSURIMissing
+	}
+
+	jwksURLStr, ok := jwksURL.(string)
+	if !ok {
+		return discoveryDocument{}, ErrJWKSURIInvalid
+	}
+
+	if jwksURLStr == "" {
+		return discoveryDocument{}, ErrJWKSURIMissing
+	}
+
+	issuer, _ := m["issuer"].(string)
+
+	algorithms, _ := claimStrings(m["id_token_signing_alg_values_supported"])
+
+	return discoveryDocument{
+		Issuer:              issuer,
+		JWKSURI:             jwksURLStr,
+		SupportedAlgorithms: algorithms,
+	}, nil
+}
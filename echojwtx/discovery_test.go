@@ -0,0 +1,97 @@
+package echojwtx
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func FuzzParseDiscovery(f *testing.F) {
+	f.Add([]byte(`{"issuer":"https://issuer.example.com","jwks_uri":"https://issuer.example.com/.well-known/jwks.json"}`))
+	f.Add([]byte(`{"issuer":"https://issuer.example.com"}`))
+	f.Add([]byte(`{"jwks_uri":1}`))
+	f.Add([]byte(`{"jwks_uri":null}`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(``))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		doc, err := parseDiscovery(data)
+		if err != nil {
+			assert.Empty(t, doc, "expected no discovery document on error")
+
+			return
+		}
+
+		assert.NotEmpty(t, doc.JWKSURI, "expected jwks uri without error")
+		assert.True(t, json.Valid(data), "expected error on invalid json")
+	})
+}
+
+func TestParseDiscovery(t *testing.T) {
+	testCases := []struct {
+		name      string
+		data      string
+		expectDoc discoveryDocument
+		expectErr error
+	}{
+		{
+			"valid",
+			`{"jwks_uri":"https://issuer.example.com/.well-known/jwks.json"}`,
+			discoveryDocument{JWKSURI: "https://issuer.example.com/.well-known/jwks.json"},
+			nil,
+		},
+		{
+			"with issuer",
+			`{"issuer":"https://issuer.example.com","jwks_uri":"https://issuer.example.com/.well-known/jwks.json"}`,
+			discoveryDocument{Issuer: "https://issuer.example.com", JWKSURI: "https://issuer.example.com/.well-known/jwks.json"},
+			nil,
+		},
+		{
+			"with supported algorithms",
+			`{"jwks_uri":"https://issuer.example.com/.well-known/jwks.json","id_token_signing_alg_values_supported":["RS256","ES256"]}`,
+			discoveryDocument{JWKSURI: "https://issuer.example.com/.well-known/jwks.json", SupportedAlgorithms: []string{"RS256", "ES256"}},
+			nil,
+		},
+		{
+			"jwks_uri missing",
+			`{"issuer":"https://issuer.example.com"}`,
+			discoveryDocument{},
+			ErrJWKSURIMissing,
+		},
+		{
+			"jwks_uri not a string",
+			`{"jwks_uri":1}`,
+			discoveryDocument{},
+			ErrJWKSURIInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := parseDiscovery([]byte(tc.data))
+
+			assert.ErrorIs(t, err, tc.expectErr, "unexpected error")
+			assert.Equal(t, tc.expectDoc, doc, "unexpected discovery document")
+		})
+	}
+}
+
+func TestNormalizeIssuer(t *testing.T) {
+	testCases := []struct {
+		issuer string
+		expect string
+	}{
+		{"https://issuer.example.com", "https://issuer.example.com"},
+		{"https://issuer.example.com/", "https://issuer.example.com"},
+		{"HTTPS://Issuer.Example.com/Realm/", "https://issuer.example.com/Realm"},
+		{"accounts.google.com", "accounts.google.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.issuer, func(t *testing.T) {
+			assert.Equal(t, tc.expect, normalizeIssuer(tc.issuer), "unexpected normalized issuer")
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type downstreamTokenContext struct{}
+
+// WithDownstreamTokenMinter sets a function called with the validated claims of every authenticated request to
+// mint a derived token, such as a narrowed internal token for calls to downstream services. The minted token is
+// stored in the request context and retrieved with DownstreamToken. By default a minting error is logged as a
+// warning and the request continues without a downstream token, see WithDownstreamTokenRequired.
+func WithDownstreamTokenMinter(fn func(claims jwt.MapClaims) (string, error)) Opts {
+	return func(a *Auth) {
+		a.downstreamTokenMinter = fn
+	}
+}
+
+// WithDownstreamTokenRequired rejects requests with a 500 when the downstream token minter returns an error,
+// instead of continuing without a downstream token.
+func WithDownstreamTokenRequired() Opts {
+	return func(a *Auth) {
+		a.downstreamTokenRequired = true
+	}
+}
+
+// mintDownstreamToken mints and stores the downstream token for the validated claims.
+func (a *Auth) mintDownstreamToken(c echo.Context, claims jwt.MapClaims) error {
+	if a.downstreamTokenMinter == nil {
+		return nil
+	}
+
+	token, err := a.downstreamTokenMinter(claims)
+	if err != nil {
+		if a.downstreamTokenRequired {
+			a.requestLogger(c).Error("jwt user downstream token minting failed", zap.Error(err))
+
+			return echo.NewHTTPError(http.StatusInternalServerError, "unable to mint downstream token").SetInternal(err)
+		}
+
+		a.requestLogger(c).Warn("jwt user downstream token minting failed, continuing without", zap.Error(err))
+
+		return nil
+	}
+
+	c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), downstreamTokenContext{}, token)))
+
+	return nil
+}
+
+// DownstreamToken retrieves the token minted by the downstream token minter for the authenticated request from
+// the context. False is returned if no token was minted.
+func DownstreamToken(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(downstreamTokenContext{}).(string)
+
+	return token, ok
+}
@@ -0,0 +1,113 @@
+package echojwtx_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestDownstreamTokenMinter(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	errMint := errors.New("mint failed")
+
+	testCases := []struct {
+		name             string
+		mintErr          error
+		opts             []echojwtx.Opts
+		expectStatusCode int
+		expectToken      string
+		expectActor      string
+	}{
+		{
+			"minted",
+			nil,
+			nil,
+			http.StatusOK,
+			"downstream:urn:test:user",
+			"urn:test:user",
+		},
+		{
+			"mint error continues",
+			errMint,
+			nil,
+			http.StatusOK,
+			"",
+			"urn:test:user",
+		},
+		{
+			"mint error required",
+			errMint,
+			[]echojwtx.Opts{echojwtx.WithDownstreamTokenRequired()},
+			http.StatusInternalServerError,
+			"",
+			"",
+		},
+		{
+			"mint error required never reject",
+			errMint,
+			[]echojwtx.Opts{echojwtx.WithDownstreamTokenRequired(), echojwtx.WithNeverReject()},
+			http.StatusOK,
+			"",
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			minter := echojwtx.WithDownstreamTokenMinter(func(claims jwt.MapClaims) (string, error) {
+				if tc.mintErr != nil {
+					return "", tc.mintErr
+				}
+
+				return "downstream:" + claims["sub"].(string), nil
+			})
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, append(tc.opts, minter)...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			var (
+				token    string
+				actor    string
+				identity bool
+			)
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				token, _ = echojwtx.DownstreamToken(c.Request().Context())
+				actor = echojwtx.Actor(c)
+				_, identity = echojwtx.IdentityFromContext(c.Request().Context())
+
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+				"iss": issuer,
+				"sub": "urn:test:user",
+			})))
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+			assert.Equal(t, tc.expectToken, token, "unexpected downstream token")
+			assert.Equal(t, tc.expectActor, actor, "unexpected actor")
+			assert.Equal(t, tc.expectActor != "", identity, "unexpected identity presence")
+		})
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/golang-jwt/jwt/v5"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// ReasonMissingToken is the reason code for requests without a token.
+	ReasonMissingToken = "missing_token"
+
+	// ReasonMalformedToken is the reason code for tokens which can't be parsed.
+	ReasonMalformedToken = "malformed_token"
+
+	// ReasonTokenExpired is the reason code for expired tokens.
+	ReasonTokenExpired = "token_expired"
+
+	// ReasonTokenNotValidYet is the reason code for tokens used before their nbf or iat.
+	ReasonTokenNotValidYet = "token_not_valid_yet"
+
+	// ReasonInvalidSignature is the reason code for tokens with an invalid signature.
+	ReasonInvalidSignature = "invalid_signature"
+
+	// ReasonUnknownKey is the reason code for tokens signed by an unknown key.
+	ReasonUnknownKey = "unknown_key"
+
+	// ReasonInvalidAudience is the reason code for tokens with an invalid audience.
+	ReasonInvalidAudience = "invalid_audience"
+
+	// ReasonInvalidIssuer is the reason code for tokens with an invalid issuer.
+	ReasonInvalidIssuer = "invalid_issuer"
+
+	// ReasonInsufficientScope is the reason code for valid tokens which were not granted the required scopes,
+	// matching the RFC 6750 insufficient_scope error code.
+	ReasonInsufficientScope = "insufficient_scope"
+
+	// ReasonForbidden is the reason code for valid tokens which are not permitted for any other reason, such as
+	// missing roles or a denied subject.
+	ReasonForbidden = "forbidden"
+
+	// ReasonUnavailable is the reason code for tokens which couldn't be validated as the keys are unavailable.
+	ReasonUnavailable = "unavailable"
+
+	// ReasonInvalidToken is the reason code for any other invalid token.
+	ReasonInvalidToken = "invalid_token"
+)
+
+// ErrorReason returns the machine-readable reason code classifying an authentication error.
+// The reason never includes token content.
+func ErrorReason(err error) string {
+	var (
+		extractionErr *echojwt.TokenExtractionError
+		httpErr       *echo.HTTPError
+	)
+
+	switch {
+	case errors.Is(err, ErrEmptyBearerToken):
+		// the client sent a bearer token, even if empty, matching the invalid_token challenge.
+		return ReasonInvalidToken
+	case errors.As(err, &extractionErr), errors.Is(err, ErrMissingAuthorization):
+		return ReasonMissingToken
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ReasonTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued), errors.Is(err, errIssuedInFuture):
+		return ReasonTokenNotValidYet
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, ErrAlgorithmNone):
+		return ReasonInvalidSignature
+	case errors.Is(err, ErrJWKSRefreshTimeout), errors.Is(err, ErrCircuitOpen):
+		return ReasonUnavailable
+	case errors.Is(err, keyfunc.ErrKIDNotFound), errors.Is(err, keyfunc.ErrKID), errors.Is(err, errKIDNotAllowed):
+		return ReasonUnknownKey
+	case errors.Is(err, jwt.ErrTokenMalformed), errors.Is(err, ErrInvalidAuthScheme), errors.Is(err, ErrMalformedBearerToken),
+		errors.Is(err, ErrUnsupportedCompression):
+		return ReasonMalformedToken
+	case errors.Is(err, errInvalidAudience), errors.Is(err, errIssuerAudienceNotAllowed), errors.Is(err, errIssuerAsAudience):
+		return ReasonInvalidAudience
+	case errors.Is(err, errInvalidIssuer):
+		return ReasonInvalidIssuer
+	case errors.Is(err, errInsufficientScope):
+		return ReasonInsufficientScope
+	case errors.As(err, &httpErr) && httpErr.Code == http.StatusForbidden:
+		return ReasonForbidden
+	default:
+		return ReasonInvalidToken
+	}
+}
+
+// WithReasonHeader sets a response header with the reason code for authentication failures.
+// See ErrorReason for the possible values.
+func WithReasonHeader(name string) Opts {
+	return func(a *Auth) {
+		a.reasonHeader = name
+	}
+}
+
+// handleTokenError implements echojwt.Config.ErrorHandler.
+// The ErrorHandler provided in the JWTConfig is called if set, otherwise a 401 error is returned, or a 503
+// error if the request timed out waiting on a JWKS refresh or the issuer circuit breaker is open. See
+// rejectionError.
+func (a *Auth) handleTokenError(c echo.Context, err error) error {
+	a.authFailed(c, err)
+
+	if ErrorReason(err) == ReasonUnavailable {
+		a.recordInfraError(err)
+	}
+
+	if a.neverReject {
+		if a.dryRun {
+			a.reportDryRun(c, err)
+		}
+
+		a.continueUnauthenticated(c, err)
+
+		return nil
+	}
+
+	if a.errorHandler != nil {
+		return a.errorHandler(c, err)
+	}
+
+	if errors.Is(err, ErrEmptyBearerToken) {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, bearerScheme+` error="invalid_token", error_description="`+err.Error()+`"`)
+
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error()).SetInternal(err)
+	}
+
+	return rejectionError(err)
+}
+
+// rejectionError returns the *echo.HTTPError a request is rejected with for the classified error, so the echo
+// HTTPErrorHandler renders every rejection consistently. An *echo.HTTPError in the chain is returned as is.
+// See ErrorReason for the classification.
+func rejectionError(err error) *echo.HTTPError {
+	var httpErr *echo.HTTPError
+
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+
+	switch ErrorReason(err) {
+	case ReasonUnavailable:
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "unable to validate jwt").SetInternal(err)
+	case ReasonInsufficientScope:
+		return echo.NewHTTPError(http.StatusForbidden, "insufficient scope").SetInternal(err)
+	}
+
+	var parsingErr *echojwt.TokenParsingError
+
+	message := "invalid or expired jwt"
+	if !errors.As(err, &parsingErr) {
+		message = "missing or malformed jwt"
+	}
+
+	return echo.NewHTTPError(http.StatusUnauthorized, message).SetInternal(err)
+}
+
+// setInsufficientScopeChallenge sets the RFC 6750 WWW-Authenticate challenge for insufficient scope errors.
+func setInsufficientScopeChallenge(c echo.Context, err error) {
+	if errors.Is(err, errInsufficientScope) {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, bearerScheme+` error="insufficient_scope"`)
+	}
+}
+
+// authFailed is called for every request rejected by the middleware.
+func (a *Auth) authFailed(c echo.Context, err error) {
+	a.finishValidation(c)
+	a.audit(c, AuditOutcomeFailure, err)
+	a.recordMetrics(c, AuditOutcomeFailure, err)
+
+	if a.reasonHeader != "" {
+		c.Response().Header().Set(a.reasonHeader, ErrorReason(err))
+	}
+}
@@ -0,0 +1,270 @@
+package echojwtx_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestReasonHeader(t *testing.T) {
+	testCases := []struct {
+		name         string
+		claims       func(issuer string) map[string]interface{}
+		token        string
+		expectReason string
+	}{
+		{
+			"valid token",
+			func(issuer string) map[string]interface{} {
+				return map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "testaud"}
+			},
+			"",
+			"",
+		},
+		{
+			"missing token",
+			nil,
+			"",
+			echojwtx.ReasonMissingToken,
+		},
+		{
+			"malformed token",
+			nil,
+			"not-a-token",
+			echojwtx.ReasonMalformedToken,
+		},
+		{
+			"expired token",
+			func(issuer string) map[string]interface{} {
+				return map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "testaud", "exp": time.Now().Add(-time.Hour).Unix()}
+			},
+			"",
+			echojwtx.ReasonTokenExpired,
+		},
+		{
+			"invalid audience",
+			func(issuer string) map[string]interface{} {
+				return map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "otheraud"}
+			},
+			"",
+			echojwtx.ReasonInvalidAudience,
+		},
+	}
+
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer:   issuer,
+			Audience: "testaud",
+		},
+		echojwtx.WithReasonHeader("X-Auth-Reason"),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token := tc.token
+
+			if tc.claims != nil {
+				token = testHelperMustSignClaims(tc.claims(issuer))
+			}
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+			assert.Equal(t, tc.expectReason, rec.Header().Get("X-Auth-Reason"), "unexpected reason header")
+
+			if token != "" {
+				assert.NotContains(t, rec.Body.String(), token, "expected response not to contain token")
+			}
+		})
+	}
+
+	t.Run("empty bearer token", func(t *testing.T) {
+		req := testHelperRequest(http.MethodGet, "/test", "")
+		req.Header.Set(echo.HeaderAuthorization, "Bearer ")
+
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, echojwtx.ReasonInvalidToken, rec.Header().Get("X-Auth-Reason"), "unexpected reason header")
+		assert.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), `error="invalid_token"`, "unexpected challenge")
+	})
+}
+
+func TestForbiddenReason(t *testing.T) {
+	testCases := []struct {
+		name            string
+		path            string
+		claims          map[string]interface{}
+		expectReason    string
+		expectChallenge string
+	}{
+		{
+			"insufficient scope",
+			"/test",
+			map[string]interface{}{"scope": "other"},
+			echojwtx.ReasonInsufficientScope,
+			`Bearer error="insufficient_scope"`,
+		},
+		{
+			"missing role",
+			"/test",
+			map[string]interface{}{"scope": "read"},
+			echojwtx.ReasonForbidden,
+			"",
+		},
+		{
+			"insufficient route scope",
+			"/admin",
+			map[string]interface{}{"scope": "read", "realm_access": map[string]interface{}{"roles": []string{"user"}}},
+			echojwtx.ReasonInsufficientScope,
+			`Bearer error="insufficient_scope"`,
+		},
+	}
+
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: issuer,
+		},
+		echojwtx.WithReasonHeader("X-Auth-Reason"),
+		echojwtx.WithRequiredScopes("read"),
+		echojwtx.WithKeycloakRoles("", "user"),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	handler := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	e.GET("/test", handler)
+	e.GET("/admin", handler, auth.RequireScopes("admin"))
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := map[string]interface{}{"iss": issuer, "sub": "urn:test:user"}
+
+			for key, value := range tc.claims {
+				claims[key] = value
+			}
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, tc.path, testHelperMustSignClaims(claims)))
+
+			assert.Equal(t, http.StatusForbidden, rec.Code, "expected 403 response from test server")
+			assert.Equal(t, tc.expectReason, rec.Header().Get("X-Auth-Reason"), "unexpected reason header")
+			assert.Equal(t, tc.expectChallenge, rec.Header().Get(echo.HeaderWWWAuthenticate), "unexpected challenge")
+		})
+	}
+}
+
+func TestRejectionHTTPError(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	testCases := []struct {
+		name       string
+		token      string
+		expectCode int
+	}{
+		{
+			"missing token",
+			"",
+			http.StatusUnauthorized,
+		},
+		{
+			"malformed token",
+			"not-a-token",
+			http.StatusUnauthorized,
+		},
+		{
+			"invalid audience",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "other", "scope": "read"}),
+			http.StatusUnauthorized,
+		},
+		{
+			"expired token",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "testaud", "scope": "read", "exp": time.Now().Add(-time.Hour).Unix()}),
+			http.StatusUnauthorized,
+		},
+		{
+			"insufficient scope",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "testaud", "scope": "other"}),
+			http.StatusForbidden,
+		},
+	}
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer:   issuer,
+			Audience: "testaud",
+		},
+		echojwtx.WithRequiredScopes("read"),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotErr error
+
+			e := echo.New()
+
+			e.HTTPErrorHandler = func(err error, c echo.Context) {
+				gotErr = err
+
+				_ = c.NoContent(http.StatusTeapot)
+			}
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", tc.token))
+
+			assert.Equal(t, http.StatusTeapot, rec.Code, "expected response to be written by the error handler")
+
+			var httpErr *echo.HTTPError
+
+			require.Truef(t, errors.As(gotErr, &httpErr), "expected *echo.HTTPError, got %T", gotErr)
+
+			assert.Equal(t, tc.expectCode, httpErr.Code, "unexpected error code")
+			assert.NotEmpty(t, httpErr.Message, "expected error message")
+		})
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"errors"
+	"strings"
+
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const bearerScheme = "Bearer"
+
+var (
+	// ErrEmptyBearerToken is returned when the Authorization header has the Bearer scheme without a token.
+	ErrEmptyBearerToken = errors.New("empty bearer token")
+
+	// ErrMissingAuthorization is returned when the Authorization header is empty.
+	ErrMissingAuthorization = errors.New("missing authorization header")
+
+	// ErrInvalidAuthScheme is returned when the Authorization header does not use the expected scheme.
+	ErrInvalidAuthScheme = errors.New("invalid authorization scheme")
+
+	// ErrMalformedBearerToken is returned when the Authorization header token is not a valid token68 value.
+	ErrMalformedBearerToken = errors.New("malformed bearer token")
+
+	// ErrDuplicateAuthorization is returned when a request has more than one Authorization header.
+	ErrDuplicateAuthorization = errors.New("multiple authorization headers")
+)
+
+// DuplicateAuthHeaderPolicy defines how requests with more than one Authorization header are handled.
+type DuplicateAuthHeaderPolicy int
+
+const (
+	// DuplicateAuthHeaderReject rejects requests with more than one Authorization header. This is the default,
+	// as duplicate headers often indicate a request smuggling attempt.
+	DuplicateAuthHeaderReject DuplicateAuthHeaderPolicy = iota
+
+	// DuplicateAuthHeaderFirst validates the first Authorization header, ignoring the rest.
+	DuplicateAuthHeaderFirst
+
+	// DuplicateAuthHeaderLast validates the last Authorization header, ignoring the rest.
+	DuplicateAuthHeaderLast
+)
+
+// ExtractBearer returns the token from an Authorization header value using the Bearer scheme.
+// See ExtractToken for details.
+func ExtractBearer(header string) (string, error) {
+	return ExtractToken(header, bearerScheme)
+}
+
+// ExtractToken returns the token from an Authorization header value using the provided scheme.
+// The scheme is matched case-insensitively as defined by RFC 7235, surrounding whitespace is ignored and any
+// number of spaces may separate the scheme and the token. The token must be a single token68 value.
+//
+// ErrMissingAuthorization is returned for an empty header, ErrInvalidAuthScheme if the scheme doesn't match,
+// ErrEmptyBearerToken if the header only contains the scheme and ErrMalformedBearerToken if the token is invalid.
+func ExtractToken(header, scheme string) (string, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return "", ErrMissingAuthorization
+	}
+
+	headerScheme, token, _ := strings.Cut(header, " ")
+
+	if !strings.EqualFold(headerScheme, scheme) {
+		return "", ErrInvalidAuthScheme
+	}
+
+	token = strings.TrimLeft(token, " ")
+	if token == "" {
+		return "", ErrEmptyBearerToken
+	}
+
+	if !validToken68(token) {
+		return "", ErrMalformedBearerToken
+	}
+
+	return token, nil
+}
+
+// validToken68 returns true if the value matches the token68 syntax of RFC 7235.
+func validToken68(value string) bool {
+	trimmed := strings.TrimRight(value, "=")
+	if trimmed == "" {
+		return false
+	}
+
+	for _, r := range trimmed {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-._~+/", r):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// WithTokenLookup sets where tokens are extracted from using the echojwt TokenLookup syntax, such as
+// "query:access_token" or "header:Authorization:Bearer ,query:access_token". This takes precedence over a
+// TokenLookup in the JWTConfig regardless of the order options are provided in.
+//
+// A query lookup allows authenticating WebSocket connections, as browsers can't set headers on the upgrade
+// request. The middleware validates the upgrade request before the handler performs the upgrade, so the actor
+// is available from the echo context and the request context passed to the WebSocket handler. Note the token is
+// only validated once during the handshake and is not checked again for the lifetime of the connection, and
+// tokens carried in query parameters may be recorded in access logs. gRPC-Web requests carry the token in the
+// Authorization header like any other request and need no additional configuration.
+func WithTokenLookup(lookup string) Opts {
+	return func(a *Auth) {
+		a.tokenLookup = lookup
+	}
+}
+
+// authorizationHeaderLookup returns true if tokens are looked up from the Authorization header.
+func (a *Auth) authorizationHeaderLookup() bool {
+	if a.JWTConfig.TokenLookup == "" {
+		return len(a.JWTConfig.TokenLookupFuncs) == 0
+	}
+
+	return strings.Contains(a.JWTConfig.TokenLookup, "header:"+echo.HeaderAuthorization)
+}
+
+// checkEmptyBearer returns an invalid token error if an Authorization header has the Bearer scheme without a token.
+func (a *Auth) checkEmptyBearer(c echo.Context) error {
+	if !a.authorizationHeaderLookup() {
+		return nil
+	}
+
+	for _, value := range c.Request().Header.Values(echo.HeaderAuthorization) {
+		if _, err := ExtractBearer(value); errors.Is(err, ErrEmptyBearerToken) {
+			return &echojwt.TokenParsingError{Err: ErrEmptyBearerToken}
+		}
+	}
+
+	return nil
+}
+
+// WithDuplicateAuthHeaderPolicy sets how requests with more than one Authorization header are handled, such as
+// those sent by a misbehaving proxy. By default they're rejected with DuplicateAuthHeaderReject.
+// Duplicate headers are logged as a warning regardless of the policy.
+func WithDuplicateAuthHeaderPolicy(policy DuplicateAuthHeaderPolicy) Opts {
+	return func(a *Auth) {
+		a.duplicateAuthHeaderPolicy = policy
+	}
+}
+
+// checkDuplicateAuthHeader applies the duplicate Authorization header policy, returning an error if the request
+// is rejected or otherwise keeping only the selected header.
+func (a *Auth) checkDuplicateAuthHeader(c echo.Context) error {
+	if !a.authorizationHeaderLookup() {
+		return nil
+	}
+
+	values := c.Request().Header.Values(echo.HeaderAuthorization)
+	if len(values) < 2 {
+		return nil
+	}
+
+	a.requestLogger(c).Warn("jwt user request has multiple authorization headers", zap.Int("count", len(values)))
+
+	switch a.duplicateAuthHeaderPolicy {
+	case DuplicateAuthHeaderFirst:
+		c.Request().Header.Set(echo.HeaderAuthorization, values[0])
+	case DuplicateAuthHeaderLast:
+		c.Request().Header.Set(echo.HeaderAuthorization, values[len(values)-1])
+	default:
+		return &echojwt.TokenParsingError{Err: ErrDuplicateAuthorization}
+	}
+
+	return nil
+}
+
+// WithCaseInsensitiveScheme sets whether the Bearer scheme of the Authorization header is matched
+// case-insensitively. Authentication schemes are case-insensitive as defined by RFC 7235, so by default clients
+// sending bearer or BEARER are accepted. Disabling this rejects any scheme which isn't exactly Bearer.
+func WithCaseInsensitiveScheme(enabled bool) Opts {
+	return func(a *Auth) {
+		a.caseSensitiveScheme = !enabled
+	}
+}
+
+// checkSchemeCase returns an invalid scheme error if case-sensitive scheme matching is enabled and an
+// Authorization header has the Bearer scheme in a different case.
+func (a *Auth) checkSchemeCase(c echo.Context) error {
+	if !a.caseSensitiveScheme || !a.authorizationHeaderLookup() {
+		return nil
+	}
+
+	for _, value := range c.Request().Header.Values(echo.HeaderAuthorization) {
+		scheme, _, _ := strings.Cut(strings.TrimSpace(value), " ")
+
+		if strings.EqualFold(scheme, bearerScheme) && scheme != bearerScheme {
+			return &echojwt.TokenParsingError{Err: ErrInvalidAuthScheme}
+		}
+	}
+
+	return nil
+}
+
+// tokenError handles token errors found outside of echojwt the same way echojwt handles errors.
+func (a *Auth) tokenError(c echo.Context, next echo.HandlerFunc, err error) error {
+	hErr := a.JWTConfig.ErrorHandler(c, err)
+	if a.JWTConfig.ContinueOnIgnoredError && hErr == nil {
+		return next(c)
+	}
+
+	return hErr
+}
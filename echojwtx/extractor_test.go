@@ -0,0 +1,340 @@
+package echojwtx_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/net/websocket"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestEmptyBearerToken(t *testing.T) {
+	_, issuer, closer := OAuthTestClient("urn:test:user", "")
+	defer closer()
+
+	testCases := []struct {
+		name   string
+		header string
+	}{
+		{
+			"no space",
+			"Bearer",
+		},
+		{
+			"trailing space",
+			"Bearer ",
+		},
+		{
+			"multiple spaces",
+			"Bearer  ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotErr error
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithJWTConfig(echojwt.Config{
+					ErrorHandler: func(c echo.Context, err error) error {
+						gotErr = err
+
+						return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+					},
+				}),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, http.DefaultClient, auth.Middleware(), http.MethodGet, "/test", http.Header{
+				echo.HeaderAuthorization: []string{tc.header},
+			})
+
+			assert.Equal(t, http.StatusUnauthorized, statusCode, "expected 401 response from test server")
+			assert.ErrorIs(t, gotErr, echojwtx.ErrEmptyBearerToken, "expected empty bearer token error")
+			assert.True(t, errors.Is(gotErr, echojwt.ErrJWTInvalid), "expected invalid token error")
+		})
+	}
+}
+
+func TestExtractBearer(t *testing.T) {
+	testCases := []struct {
+		name        string
+		header      string
+		expectToken string
+		expectErr   error
+	}{
+		{
+			"valid",
+			"Bearer abc.def.ghi",
+			"abc.def.ghi",
+			nil,
+		},
+		{
+			"lowercase scheme",
+			"bearer abc.def.ghi",
+			"abc.def.ghi",
+			nil,
+		},
+		{
+			"extra spaces",
+			"  Bearer   abc.def.ghi  ",
+			"abc.def.ghi",
+			nil,
+		},
+		{
+			"padded token",
+			"Bearer abc==",
+			"abc==",
+			nil,
+		},
+		{
+			"empty header",
+			"",
+			"",
+			echojwtx.ErrMissingAuthorization,
+		},
+		{
+			"no scheme",
+			"abc.def.ghi",
+			"",
+			echojwtx.ErrInvalidAuthScheme,
+		},
+		{
+			"wrong scheme",
+			"Basic dXNlcjpwYXNz",
+			"",
+			echojwtx.ErrInvalidAuthScheme,
+		},
+		{
+			"scheme only",
+			"Bearer ",
+			"",
+			echojwtx.ErrEmptyBearerToken,
+		},
+		{
+			"multiple tokens",
+			"Bearer abc def",
+			"",
+			echojwtx.ErrMalformedBearerToken,
+		},
+		{
+			"invalid characters",
+			"Bearer abc,def",
+			"",
+			echojwtx.ErrMalformedBearerToken,
+		},
+		{
+			"padding only",
+			"Bearer ==",
+			"",
+			echojwtx.ErrMalformedBearerToken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := echojwtx.ExtractBearer(tc.header)
+
+			assert.ErrorIs(t, err, tc.expectErr, "unexpected error")
+			assert.Equal(t, tc.expectToken, token, "unexpected token")
+		})
+	}
+}
+
+func TestCaseInsensitiveScheme(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	token := testHelperMustSignClaims(map[string]interface{}{
+		"iss": issuer,
+		"sub": "urn:test:user",
+	})
+
+	testCases := []struct {
+		name             string
+		scheme           string
+		opts             []echojwtx.Opts
+		expectStatusCode int
+	}{
+		{"default Bearer", "Bearer", nil, http.StatusOK},
+		{"default bearer", "bearer", nil, http.StatusOK},
+		{"default BEARER", "BEARER", nil, http.StatusOK},
+		{"case-sensitive Bearer", "Bearer", []echojwtx.Opts{echojwtx.WithCaseInsensitiveScheme(false)}, http.StatusOK},
+		{"case-sensitive bearer", "bearer", []echojwtx.Opts{echojwtx.WithCaseInsensitiveScheme(false)}, http.StatusUnauthorized},
+		{"case-sensitive BEARER", "BEARER", []echojwtx.Opts{echojwtx.WithCaseInsensitiveScheme(false)}, http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, tc.opts...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set(echo.HeaderAuthorization, tc.scheme+" "+token)
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestDuplicateAuthHeaderPolicy(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	valid := "Bearer " + testHelperMustSignClaims(map[string]interface{}{
+		"iss": issuer,
+		"sub": "urn:test:user",
+	})
+
+	invalid := "Bearer invalid"
+
+	testCases := []struct {
+		name             string
+		opts             []echojwtx.Opts
+		headers          []string
+		expectStatusCode int
+	}{
+		{
+			"rejected by default",
+			nil,
+			[]string{valid, valid},
+			http.StatusUnauthorized,
+		},
+		{
+			"first",
+			[]echojwtx.Opts{echojwtx.WithDuplicateAuthHeaderPolicy(echojwtx.DuplicateAuthHeaderFirst)},
+			[]string{valid, invalid},
+			http.StatusOK,
+		},
+		{
+			"first invalid",
+			[]echojwtx.Opts{echojwtx.WithDuplicateAuthHeaderPolicy(echojwtx.DuplicateAuthHeaderFirst)},
+			[]string{invalid, valid},
+			http.StatusUnauthorized,
+		},
+		{
+			"last",
+			[]echojwtx.Opts{echojwtx.WithDuplicateAuthHeaderPolicy(echojwtx.DuplicateAuthHeaderLast)},
+			[]string{invalid, valid},
+			http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.WarnLevel)
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, append(tc.opts, echojwtx.WithLogger(zap.New(core)))...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+
+			for _, header := range tc.headers {
+				req.Header.Add(echo.HeaderAuthorization, header)
+			}
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+			assert.Equal(t, 1, logs.FilterMessage("jwt user request has multiple authorization headers").Len(), "expected duplicate header warning")
+		})
+	}
+}
+
+func TestTokenLookupWebSocket(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithTokenLookup("query:access_token"))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/ws", func(c echo.Context) error {
+		websocket.Handler(func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			ctxActor, _ := ws.Request().Context().Value(echojwtx.ActorCtxKey).(string)
+
+			_ = websocket.Message.Send(ws, echojwtx.Actor(c)+" "+ctxActor)
+		}).ServeHTTP(c.Response(), c.Request())
+
+		return nil
+	})
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+
+	token := testHelperMustSignClaims(map[string]interface{}{
+		"iss": issuer,
+		"sub": "urn:test:user",
+	})
+
+	ws, err := websocket.Dial(wsURL+"?access_token="+token, "", srv.URL)
+	require.NoError(t, err, "no error expected dialing websocket")
+
+	defer ws.Close()
+
+	var msg string
+
+	require.NoError(t, websocket.Message.Receive(ws, &msg), "no error expected receiving message")
+
+	assert.Equal(t, "urn:test:user urn:test:user", msg, "expected actor in echo and request context")
+
+	_, err = websocket.Dial(wsURL, "", srv.URL)
+	assert.Error(t, err, "expected upgrade without a token to be rejected")
+
+	_, err = websocket.Dial(wsURL+"?access_token=invalid", "", srv.URL)
+	assert.Error(t, err, "expected upgrade with an invalid token to be rejected")
+}
@@ -0,0 +1,162 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// NewStreamServerInterceptor creates a new auth handler as NewAuth does and returns a gRPC stream server
+// interceptor for it. See Auth.StreamServerInterceptor.
+func NewStreamServerInterceptor(ctx context.Context, config AuthConfig, options ...Opts) (grpc.StreamServerInterceptor, error) {
+	auth, err := NewAuth(ctx, config, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.StreamServerInterceptor(), nil
+}
+
+// StreamServerInterceptor returns a gRPC stream server interceptor validating the bearer token in the authorization
+// metadata when the stream is established. The token is validated by the same middleware as http requests, with
+// the incoming metadata as the request headers and the full method name, such as /pkg.Service/Method, as the
+// request path. The stream context passed to the handler has the actor stored under ActorCtxKey along with the
+// Identity and any other values stored in the request context, such as by WithAuthenticatedAt.
+//
+// Unauthenticated streams are rejected with codes.Unauthenticated, streams which aren't permitted with
+// codes.PermissionDenied and streams which couldn't be validated because the keys are unavailable with
+// codes.Unavailable.
+//
+// Options which only affect the echo context or the http response don't apply: WithClaimHeaders,
+// WithContextClaims, WithLoggerEnrichment, WithReasonHeader, WithClearContextOnResponse and WithDebugRoutes. The
+// stream is never passed through unauthenticated, with WithNeverReject or WithDryRun streams which would continue
+// unauthenticated are rejected with codes.Unauthenticated, though dry run failures are still reported.
+func (a *Auth) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticateGRPC(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authenticatedServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticatedServerStream is a grpc.ServerStream with the authenticated context.
+type authenticatedServerStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream.
+func (s *authenticatedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticateGRPC validates the token in the incoming metadata of ctx by running the middleware over an
+// equivalent http request, returning the authenticated context or a gRPC status error.
+func (a *Auth) authenticateGRPC(ctx context.Context, fullMethod string) (context.Context, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fullMethod, nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	for key, values := range md {
+		// pseudo headers such as :authority aren't http headers.
+		if strings.HasPrefix(key, ":") {
+			continue
+		}
+
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	var authCtx context.Context
+
+	c := echo.New().NewContext(req, &discardResponseWriter{header: make(http.Header)})
+
+	err = a.Middleware()(func(c echo.Context) error {
+		authCtx = c.Request().Context()
+
+		return nil
+	})(c)
+	if err != nil {
+		return nil, grpcStatusError(err)
+	}
+
+	// streams which would continue unauthenticated, such as with WithNeverReject, are rejected.
+	if authCtx == nil {
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+
+	if _, ok := IdentityFromContext(authCtx); !ok {
+		return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+	}
+
+	return authCtx, nil
+}
+
+// grpcStatusError converts a middleware rejection into a gRPC status error.
+func grpcStatusError(err error) error {
+	var httpErr *echo.HTTPError
+
+	if !errors.As(err, &httpErr) {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	message, _ := httpErr.Message.(string)
+
+	switch httpErr.Code {
+	case http.StatusForbidden:
+		return status.Error(codes.PermissionDenied, message)
+	case http.StatusServiceUnavailable:
+		return status.Error(codes.Unavailable, message)
+	case http.StatusInternalServerError:
+		return status.Error(codes.Internal, message)
+	default:
+		return status.Error(codes.Unauthenticated, message)
+	}
+}
+
+// discardResponseWriter is a http.ResponseWriter discarding the response written while authenticating gRPC calls.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+// Header implements http.ResponseWriter.
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// Write implements http.ResponseWriter.
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *discardResponseWriter) WriteHeader(int) {}
@@ -0,0 +1,155 @@
+package echojwtx_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+type testServerStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	testCases := []struct {
+		name        string
+		token       string
+		expectCode  codes.Code
+		expectActor string
+	}{
+		{
+			"valid token",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "testaud"}),
+			codes.OK,
+			"urn:test:user",
+		},
+		{
+			"invalid audience",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "other"}),
+			codes.Unauthenticated,
+			"",
+		},
+		{
+			"malformed token",
+			"not-a-token",
+			codes.Unauthenticated,
+			"",
+		},
+		{
+			"missing token",
+			"",
+			codes.Unauthenticated,
+			"",
+		},
+	}
+
+	interceptor, err := echojwtx.NewStreamServerInterceptor(context.Background(), echojwtx.AuthConfig{
+		Issuer:   issuer,
+		Audience: "testaud",
+	})
+
+	require.NoError(t, err, "no error expected for NewStreamServerInterceptor")
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			md := metadata.MD{}
+
+			if tc.token != "" {
+				md.Set("authorization", "Bearer "+tc.token)
+			}
+
+			stream := &testServerStream{ctx: metadata.NewIncomingContext(context.Background(), md)}
+
+			var actor string
+
+			err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}, func(_ interface{}, ss grpc.ServerStream) error {
+				actor, _ = ss.Context().Value(echojwtx.ActorCtxKey).(string)
+
+				return nil
+			})
+
+			assert.Equal(t, tc.expectCode, status.Code(err), "unexpected status code")
+			assert.Equal(t, tc.expectActor, actor, "unexpected actor")
+		})
+	}
+}
+
+func TestStreamServerInterceptorOptions(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	apiKey := echojwtx.WithAPIKeyFallback("X-API-Key", func(key string) (string, bool) {
+		return "urn:test:machine", key == "s3cr3t"
+	})
+
+	testCases := []struct {
+		name        string
+		opts        []echojwtx.Opts
+		md          metadata.MD
+		expectCode  codes.Code
+		expectActor string
+	}{
+		{
+			"api key metadata",
+			[]echojwtx.Opts{apiKey},
+			metadata.Pairs("x-api-key", "s3cr3t"),
+			codes.OK,
+			"urn:test:machine",
+		},
+		{
+			"never reject missing token",
+			[]echojwtx.Opts{echojwtx.WithNeverReject()},
+			metadata.MD{},
+			codes.Unauthenticated,
+			"",
+		},
+		{
+			"dry run invalid token",
+			[]echojwtx.Opts{echojwtx.WithDryRun(func(_ echo.Context, _ error) {})},
+			metadata.Pairs("authorization", "Bearer not-a-token"),
+			codes.Unauthenticated,
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			interceptor, err := echojwtx.NewStreamServerInterceptor(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, tc.opts...)
+
+			require.NoError(t, err, "no error expected for NewStreamServerInterceptor")
+
+			stream := &testServerStream{ctx: metadata.NewIncomingContext(context.Background(), tc.md)}
+
+			var actor string
+
+			err = interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}, func(_ interface{}, ss grpc.ServerStream) error {
+				actor, _ = ss.Context().Value(echojwtx.ActorCtxKey).(string)
+
+				return nil
+			})
+
+			assert.Equal(t, tc.expectCode, status.Code(err), "unexpected status code")
+			assert.Equal(t, tc.expectActor, actor, "unexpected actor")
+		})
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
@@ -28,31 +30,62 @@ import (
 var (
 	errInvalidAudience = errors.New("invalid audience")
 	errInvalidIssuer   = errors.New("invalid issuer")
+	errActorRequired   = errors.New("actor required")
+	errInvalidToken    = errors.New("invalid token")
+	errTenantMismatch  = errors.New("token issuer does not match tenant")
+	errEmptySubject    = errors.New("token subject is missing or empty")
+
+	errIssuerAudienceNotAllowed = errors.New("issuer not allowed for audience")
+	errIssuerAsAudience         = errors.New("token audience contains its issuer")
 )
 
 // jwtHandler validates the token claims and sets the ActorKey to the token subject.
 func (a *Auth) jwtHandler(c echo.Context) error {
-	token, ok := c.Get("user").(*jwt.Token)
+	token, ok := c.Get(a.contextKey()).(*jwt.Token)
 	if !ok {
-		a.logger.Warn("jwt user is not jwt.Token")
+		a.requestLogger(c).Warn("jwt user is not jwt.Token")
 
 		return nil
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		a.logger.Warn("jwt user claims are not jwt.MapClaims type")
+		a.requestLogger(c).Warn("jwt user claims are not jwt.MapClaims type")
 
 		return nil
 	}
 
-	if err := a.validateClaims(claims); err != nil {
-		a.logger.Error("jwt user claims are not valid", zap.Error(err))
+	if err := a.validateClaims(c, claims); err != nil {
+		a.requestLogger(c).Error("jwt user claims are not valid", zap.Error(err))
+
+		if !a.dryRun {
+			return err
+		}
+
+		a.reportDryRun(c, err)
+	}
+
+	if err := a.validateAtHash(c, token, claims); err != nil {
+		a.requestLogger(c).Error("jwt user at_hash is not valid", zap.Error(err))
 
+		if !a.dryRun {
+			return err
+		}
+
+		a.reportDryRun(c, err)
+	}
+
+	// mint before the context is populated so a rejected request leaves no actor behind.
+	if err := a.mintDownstreamToken(c, claims); err != nil {
 		return err
 	}
 
-	if subject, ok := claims["sub"]; ok {
+	a.setClaimHeaders(c, claims)
+	a.setContextClaims(c, claims)
+	a.enrichLogger(c, claims)
+
+	subject, ok := claims[a.subjectClaimName()]
+	if ok {
 		// store the actor in the request context as well so it's available outside of echo contexts
 		req := c.Request()
 		req = req.WithContext(context.WithValue(req.Context(), ActorCtxKey, subject))
@@ -60,9 +93,62 @@ func (a *Auth) jwtHandler(c echo.Context) error {
 		c.Set(ActorKey, subject)
 	}
 
+	actor, _ := subject.(string)
+
+	var identity Identity = newClaimsIdentity(claims, actor, a.tokenScopes(claims))
+
+	c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), identityContext{}, identity)))
+
+	if chain := actorChain(claims); len(chain) != 0 {
+		c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), actorChainContext{}, chain)))
+	}
+
+	if a.storeAuthenticatedAt {
+		authenticatedAt, ok := c.Get(requestStartKey).(time.Time)
+		if !ok {
+			authenticatedAt = a.now()
+		}
+
+		req := c.Request()
+		req = req.WithContext(context.WithValue(req.Context(), authenticatedAtContext{}, authenticatedAt))
+		c.SetRequest(req)
+	}
+
 	return nil
 }
 
+// requestLogger returns the logger with request fields, including the matched echo route pattern.
+// The route is only known when the middleware runs after routing, which is the case for middleware
+// registered with Echo#Use or on a group or route, but not Echo#Pre.
+func (a *Auth) requestLogger(c echo.Context) *zap.Logger {
+	return a.logger.With(zap.String("route", c.Path()))
+}
+
+// stripClaimHeaders removes any client provided headers which are set from claims.
+func (a *Auth) stripClaimHeaders(c echo.Context) {
+	for _, header := range a.claimHeaders {
+		c.Request().Header.Del(header)
+	}
+}
+
+// setClaimHeaders sets the configured claim headers on the request from the provided claims.
+func (a *Auth) setClaimHeaders(c echo.Context, claims jwt.MapClaims) {
+	for claim, header := range a.claimHeaders {
+		if value, ok := claims[claim]; ok {
+			c.Request().Header.Set(header, claimString(value))
+		}
+	}
+}
+
+// setContextClaims sets the configured echo context values from the provided claims.
+func (a *Auth) setContextClaims(c echo.Context, claims jwt.MapClaims) {
+	for claim, key := range a.contextClaims {
+		if value, ok := claims[claim]; ok {
+			c.Set(key, value)
+		}
+	}
+}
+
 // Actor retrieves the ActorKey from echo Context.
 func Actor(c echo.Context) string {
 	if actor, ok := c.Get(ActorKey).(string); ok {
@@ -72,22 +158,172 @@ func Actor(c echo.Context) string {
 	return ""
 }
 
-func (a *Auth) validateClaims(claims jwt.MapClaims) error {
-	if a.audience != "" {
-		if audiences, err := claims.GetAudience(); err != nil {
-			a.logger.Error("jwt user failed to get audience", zap.Error(err), zap.Any("audience", claims["aud"]))
-		} else if !slices.Contains(audiences, a.audience) {
-			a.logger.Error("jwt user claim invalid audience", zap.Any("audience", claims["aud"]))
+// ContextWithActor sets up the echo context with the provided actor as the middleware would for a token with
+// the actor as its subject. This allows testing handlers which depend on the actor without running the
+// middleware. The actor is stored under ActorKey, and in the request context under ActorCtxKey along with an
+// Identity for the actor.
+func ContextWithActor(c echo.Context, actor string) {
+	c.SetRequest(c.Request().WithContext(RequestContextWithActor(c.Request().Context(), actor)))
+	c.Set(ActorKey, actor)
+}
+
+// RequestContextWithActor returns a copy of ctx with the provided actor stored as the middleware would for a
+// token with the actor as its subject. See ContextWithActor.
+func RequestContextWithActor(ctx context.Context, actor string) context.Context {
+	var identity Identity = newClaimsIdentity(jwt.MapClaims{"sub": actor}, actor, nil)
+
+	ctx = context.WithValue(ctx, ActorCtxKey, actor)
+
+	return context.WithValue(ctx, identityContext{}, identity)
+}
+
+// AuthenticatedAt retrieves the time the request was authenticated from the context.
+// The time is only stored when the WithAuthenticatedAt option is set.
+func AuthenticatedAt(ctx context.Context) (time.Time, bool) {
+	authenticatedAt, ok := ctx.Value(authenticatedAtContext{}).(time.Time)
+
+	return authenticatedAt, ok
+}
+
+// requiredAudience returns the audience required for the request.
+// If an audience is configured for the request method it is used, followed by the audience of the longest
+// matching path prefix, otherwise the default audience is returned.
+func (a *Auth) requiredAudience(c echo.Context) string {
+	if audience, ok := a.audienceByMethod[c.Request().Method]; ok {
+		return audience
+	}
+
+	var matched string
+
+	audience := a.audience
+
+	for prefix, prefixAudience := range a.audienceByPrefix {
+		if len(prefix) > len(matched) && strings.HasPrefix(c.Request().URL.Path, prefix) {
+			matched = prefix
+			audience = prefixAudience
+		}
+	}
+
+	return audience
+}
+
+// tokenAudiences returns the audiences from the token claims.
+// If an audience claim path is configured, audiences are read from that path instead of the aud claim.
+func (a *Auth) tokenAudiences(claims jwt.MapClaims) ([]string, error) {
+	if a.audienceClaimPath == "" {
+		return claims.GetAudience()
+	}
+
+	value, _ := claimAtPath(claims, a.audienceClaimPath)
+
+	return claimStrings(value)
+}
+
+// rawAudience returns the unparsed audience value tokenAudiences reads, for logging.
+func (a *Auth) rawAudience(claims jwt.MapClaims) interface{} {
+	if a.audienceClaimPath == "" {
+		return claims["aud"]
+	}
+
+	value, _ := claimAtPath(claims, a.audienceClaimPath)
+
+	return value
+}
+
+// validIssuer returns true if the provided issuer matches the configured issuer, a fallback issuer or one of
+// the configured issuer's aliases.
+func (a *Auth) validIssuer(issuer string) bool {
+	if issuer == a.issuer || slices.Contains(a.fallbackIssuers, issuer) {
+		return true
+	}
+
+	return slices.Contains(a.issuerAliases[a.issuer], issuer)
+}
+
+// validateClaims runs all claim validations against the token claims.
+func (a *Auth) validateClaims(c echo.Context, claims jwt.MapClaims) error {
+	validators := []func(echo.Context, jwt.MapClaims) error{
+		a.validateAudience,
+		a.validateAudienceQuorum,
+		a.validateAudienceProvider,
+		a.validateIssuer,
+		a.validateIssuerAudiencePair,
+		a.validateIssuerNotAudience,
+		a.validateIssuedAt,
+		a.validateMinIssuedAt,
+		a.validateIssuedAtWindow,
+		a.validateTokenLifetime,
+		a.validateTenantIssuer,
+		a.validateSubjectPresent,
+		a.validateSubject,
+		a.validateNonce,
+		a.validateSessionBinding,
+		a.validateScopes,
+		a.validateKeycloakRoles,
+		a.validateCertificateBinding,
+		a.validateCustomClaims,
+	}
+
+	for _, validate := range validators {
+		if err := validate(c, claims); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Auth) validateAudience(c echo.Context, claims jwt.MapClaims) error {
+	if audience := a.requiredAudience(c); audience != "" {
+		if audiences, err := a.tokenAudiences(claims); err != nil {
+			a.requestLogger(c).Error("jwt user failed to get audience", zap.Error(err), zap.Any("audience", a.rawAudience(claims)))
+
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errInvalidAudience)
+		} else if !slices.Contains(audiences, audience) {
+			a.requestLogger(c).Error("jwt user claim invalid audience", zap.Strings("audience", audiences))
 
 			return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errInvalidAudience)
 		}
 	}
 
+	return nil
+}
+
+func (a *Auth) validateAudienceQuorum(c echo.Context, claims jwt.MapClaims) error {
+	if a.audienceQuorum == 0 {
+		return nil
+	}
+
+	audiences, err := a.tokenAudiences(claims)
+	if err != nil {
+		a.requestLogger(c).Error("jwt user failed to get audience", zap.Error(err), zap.Any("audience", a.rawAudience(claims)))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errInvalidAudience)
+	}
+
+	var matched int
+
+	for _, audience := range a.quorumAudiences {
+		if slices.Contains(audiences, audience) {
+			matched++
+		}
+	}
+
+	if matched < a.audienceQuorum {
+		a.requestLogger(c).Error("jwt user claim audience quorum not met", zap.Strings("audience", audiences), zap.Int("matched", matched))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errInvalidAudience)
+	}
+
+	return nil
+}
+
+func (a *Auth) validateIssuer(c echo.Context, claims jwt.MapClaims) error {
 	if a.issuer != "" {
 		if issuer, err := claims.GetIssuer(); err != nil {
-			a.logger.Error("jwt user failed to get issuer", zap.Error(err), zap.Any("issuer", claims["iss"]))
-		} else if issuer != a.issuer {
-			a.logger.Error("jwt user claim invalid issuer", zap.Any("issuer", claims["iss"]))
+			a.requestLogger(c).Error("jwt user failed to get issuer", zap.Error(err), zap.Any("issuer", claims["iss"]))
+		} else if !a.validIssuer(issuer) {
+			a.requestLogger(c).Error("jwt user claim invalid issuer", zap.Any("issuer", claims["iss"]))
 
 			return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errInvalidIssuer)
 		}
@@ -95,3 +331,122 @@ func (a *Auth) validateClaims(claims jwt.MapClaims) error {
 
 	return nil
 }
+
+func (a *Auth) validateIssuerAudiencePair(c echo.Context, claims jwt.MapClaims) error {
+	if len(a.issuerAudiencePairs) == 0 {
+		return nil
+	}
+
+	issuer, _ := claims.GetIssuer()
+	audiences, _ := a.tokenAudiences(claims)
+
+	for _, pair := range a.issuerAudiencePairs {
+		if pair.Issuer == issuer && slices.Contains(audiences, pair.Audience) {
+			return nil
+		}
+	}
+
+	a.requestLogger(c).Error("jwt user claim issuer not allowed for audience", zap.String("issuer", issuer), zap.Strings("audience", audiences))
+
+	return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errIssuerAudienceNotAllowed)
+}
+
+func (a *Auth) validateIssuerNotAudience(c echo.Context, claims jwt.MapClaims) error {
+	if !a.rejectIssuerAsAud {
+		return nil
+	}
+
+	issuer, _ := claims.GetIssuer()
+	audiences, _ := a.tokenAudiences(claims)
+
+	if issuer == "" || !slices.Contains(audiences, issuer) {
+		return nil
+	}
+
+	a.requestLogger(c).Error("jwt user claim audience contains the issuer", zap.String("issuer", issuer), zap.Strings("audience", audiences))
+
+	return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errIssuerAsAudience)
+}
+
+func (a *Auth) validateTenantIssuer(c echo.Context, claims jwt.MapClaims) error {
+	if a.tenantHeader == "" {
+		return nil
+	}
+
+	tenant := c.Request().Header.Get(a.tenantHeader)
+
+	expected, ok := a.tenantIssuers[tenant]
+	if tenant == "" || !ok {
+		a.requestLogger(c).Error("jwt user request tenant unknown", zap.String("tenant", tenant))
+
+		return echo.NewHTTPError(http.StatusForbidden, "tenant not permitted").SetInternal(errTenantMismatch)
+	}
+
+	if issuer, _ := claims.GetIssuer(); issuer != expected {
+		a.requestLogger(c).Error("jwt user claim issuer does not match tenant", zap.String("tenant", tenant), zap.Any("issuer", claims["iss"]))
+
+		return echo.NewHTTPError(http.StatusForbidden, "tenant not permitted").SetInternal(errTenantMismatch)
+	}
+
+	return nil
+}
+
+func (a *Auth) validateSubjectPresent(c echo.Context, claims jwt.MapClaims) error {
+	if !a.requireSubject {
+		return nil
+	}
+
+	if subject, _ := claims[a.subjectClaimName()].(string); subject == "" {
+		a.requestLogger(c).Error("jwt user claim subject is missing or empty", zap.Any("subject", claims[a.subjectClaimName()]))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errEmptySubject)
+	}
+
+	return nil
+}
+
+func (a *Auth) validateSubject(c echo.Context, claims jwt.MapClaims) error {
+	if a.subjectValidator == nil {
+		return nil
+	}
+
+	subject, _ := claims[a.subjectClaimName()].(string)
+
+	if err := a.subjectValidator(subject); err != nil {
+		a.requestLogger(c).Error("jwt user claim invalid subject", zap.Error(err))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(err)
+	}
+
+	return nil
+}
+
+// WithClaimValidator adds a validator which is run over the claims of every token after all other validations.
+// Validators run in the order they're added and the first error rejects the request. An *echo.HTTPError is returned
+// as is, allowing the validator to choose the status, while any other error rejects the request with a 403.
+func WithClaimValidator(fn func(ctx context.Context, claims jwt.MapClaims) error) Opts {
+	return func(a *Auth) {
+		a.claimValidators = append(a.claimValidators, fn)
+	}
+}
+
+func (a *Auth) validateCustomClaims(c echo.Context, claims jwt.MapClaims) error {
+	for _, validate := range a.claimValidators {
+		err := validate(c.Request().Context(), claims)
+		if err == nil {
+			continue
+		}
+
+		a.requestLogger(c).Error("jwt user claims rejected by validator", zap.Error(err))
+
+		var httpErr *echo.HTTPError
+
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+
+		return echo.NewHTTPError(http.StatusForbidden, "forbidden").SetInternal(err)
+	}
+
+	return nil
+}
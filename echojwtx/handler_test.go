@@ -2,8 +2,10 @@ package echojwtx_test
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +15,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
 	"go.infratographer.com/x/echojwtx"
 )
@@ -203,3 +207,1502 @@ func TestAudienceValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestAudienceByMethod(t *testing.T) {
+	testCases := []struct {
+		name             string
+		clientAudience   string
+		method           string
+		expectStatusCode int
+	}{
+		{
+			"default audience on read",
+			"read",
+			http.MethodGet,
+			http.StatusOK,
+		},
+		{
+			"default audience on write",
+			"read",
+			http.MethodPost,
+			http.StatusUnauthorized,
+		},
+		{
+			"write audience on write",
+			"write",
+			http.MethodPost,
+			http.StatusOK,
+		},
+		{
+			"write audience on read",
+			"write",
+			http.MethodGet,
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := OAuthTestClient("urn:test:user", tc.clientAudience)
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Audience: "read",
+					Issuer:   issuer,
+				},
+				echojwtx.WithAudienceByMethod(map[string]string{
+					"post": "write",
+				}),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), tc.method, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestAudienceByPathPrefix(t *testing.T) {
+	testCases := []struct {
+		name             string
+		clientAudience   string
+		path             string
+		expectStatusCode int
+	}{
+		{
+			"default audience without matching prefix",
+			"default",
+			"/other",
+			http.StatusOK,
+		},
+		{
+			"default audience on prefix",
+			"default",
+			"/billing/invoices",
+			http.StatusUnauthorized,
+		},
+		{
+			"prefix audience",
+			"billing",
+			"/billing/invoices",
+			http.StatusOK,
+		},
+		{
+			"longest prefix audience",
+			"billing-admin",
+			"/billing/admin/users",
+			http.StatusOK,
+		},
+		{
+			"shorter prefix audience on longer prefix",
+			"billing",
+			"/billing/admin/users",
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := OAuthTestClient("urn:test:user", tc.clientAudience)
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Audience: "default",
+					Issuer:   issuer,
+				},
+				echojwtx.WithAudienceByPathPrefix(map[string]string{
+					"/billing/":       "billing",
+					"/billing/admin/": "billing-admin",
+				}),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, tc.path, nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestIssuerAudiencePairs(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	partner := "https://partner.example.com"
+
+	testCases := []struct {
+		name             string
+		issuer           string
+		audience         interface{}
+		expectStatusCode int
+	}{
+		{
+			"issuer audience",
+			issuer,
+			"api",
+			http.StatusOK,
+		},
+		{
+			"issuer one of multiple audiences",
+			issuer,
+			[]string{"other", "api"},
+			http.StatusOK,
+		},
+		{
+			"partner audience",
+			partner,
+			"shared",
+			http.StatusOK,
+		},
+		{
+			"partner issuer audience",
+			partner,
+			"api",
+			http.StatusUnauthorized,
+		},
+		{
+			"issuer partner audience",
+			issuer,
+			"shared",
+			http.StatusUnauthorized,
+		},
+	}
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: issuer,
+		},
+		echojwtx.WithFallbackIssuers(partner),
+		echojwtx.WithIssuerAudiencePairs([]echojwtx.IssuerAudiencePair{
+			{Issuer: issuer, Audience: "api"},
+			{Issuer: partner, Audience: "shared"},
+		}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+				"iss": tc.issuer,
+				"sub": "urn:test:user",
+				"aud": tc.audience,
+			})))
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestRejectIssuerAsAudience(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	testCases := []struct {
+		name             string
+		opts             []echojwtx.Opts
+		audience         interface{}
+		expectStatusCode int
+	}{
+		{
+			"issuer audience allowed by default",
+			nil,
+			issuer,
+			http.StatusOK,
+		},
+		{
+			"issuer audience",
+			[]echojwtx.Opts{echojwtx.WithRejectIssuerAsAudience()},
+			issuer,
+			http.StatusUnauthorized,
+		},
+		{
+			"issuer one of multiple audiences",
+			[]echojwtx.Opts{echojwtx.WithRejectIssuerAsAudience()},
+			[]string{"api", issuer},
+			http.StatusUnauthorized,
+		},
+		{
+			"other audience",
+			[]echojwtx.Opts{echojwtx.WithRejectIssuerAsAudience()},
+			"api",
+			http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, append([]echojwtx.Opts{echojwtx.WithReasonHeader("X-Auth-Reason")}, tc.opts...)...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+				"iss": issuer,
+				"aud": tc.audience,
+				"sub": "urn:test:user",
+			})))
+
+			assert.Equal(t, tc.expectStatusCode, rec.Code, "unexpected status code")
+
+			if tc.expectStatusCode != http.StatusOK {
+				assert.Equal(t, echojwtx.ReasonInvalidAudience, rec.Header().Get("X-Auth-Reason"), "unexpected reason")
+			}
+		})
+	}
+}
+
+func TestClaimHeaders(t *testing.T) {
+	oauthClient, issuer, closer := OAuthTestClient("urn:test:user", "")
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: issuer,
+		},
+		echojwtx.WithClaimHeaders(map[string]string{
+			"sub":    "X-User-Id",
+			"tenant": "X-Tenant",
+		}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	gotHeadersCh := make(chan http.Header, 1)
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		gotHeadersCh <- c.Request().Header.Clone()
+
+		return nil
+	})
+
+	srv := httptest.NewServer(e)
+
+	defer srv.Close()
+
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, srv.URL+"/test", nil)
+
+	require.NoError(t, err, "expected new request without error")
+
+	req.Header.Set("X-User-Id", "spoofed-user")
+	req.Header.Set("X-Tenant", "spoofed-tenant")
+
+	resp, err := oauthClient.Do(req)
+	_ = resp.Body.Close()
+
+	require.NoError(t, err, "expected response without error")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "expected 200 response from test server")
+
+	select {
+	case headers := <-gotHeadersCh:
+		assert.Equal(t, []string{"urn:test:user"}, headers.Values("X-User-Id"), "expected spoofed user header to be overwritten")
+		assert.Empty(t, headers.Values("X-Tenant"), "expected spoofed tenant header to be removed")
+	case <-time.After(chanTimeout):
+		t.Error("failed to receive headers")
+	}
+}
+
+func TestClaimHeadersNumeric(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: issuer,
+		},
+		echojwtx.WithClaimHeaders(map[string]string{
+			"account_id": "X-Account-Id",
+			"ratio":      "X-Ratio",
+			"ids":        "X-Ids",
+		}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	var headers http.Header
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		headers = c.Request().Header.Clone()
+
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+		"iss":        issuer,
+		"sub":        "urn:test:user",
+		"account_id": 1234567890123,
+		"ratio":      0.25,
+		"ids":        []interface{}{10000000, 2},
+	})))
+
+	require.Equal(t, http.StatusOK, rec.Code, "expected 200 response from test server")
+
+	assert.Equal(t, "1234567890123", headers.Get("X-Account-Id"), "expected integer claim without exponent")
+	assert.Equal(t, "0.25", headers.Get("X-Ratio"), "unexpected fractional claim")
+	assert.Equal(t, "10000000,2", headers.Get("X-Ids"), "expected array of numbers without exponent")
+}
+
+func TestIssuerAliases(t *testing.T) {
+	testCases := []struct {
+		name             string
+		tokenIssuer      func(issuer string) string
+		expectStatusCode int
+	}{
+		{
+			"configured issuer",
+			func(issuer string) string { return issuer },
+			http.StatusOK,
+		},
+		{
+			"aliased issuer",
+			func(issuer string) string { return strings.TrimPrefix(issuer, "http://") },
+			http.StatusOK,
+		},
+		{
+			"unknown issuer",
+			func(issuer string) string { return "https://unknown.example.com" },
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				return map[string]interface{}{
+					"iss": tc.tokenIssuer(issuer),
+					"sub": "urn:test:user",
+				}
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithIssuerAliases(map[string][]string{
+					issuer: {strings.TrimPrefix(issuer, "http://")},
+				}),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	_, issuer, closer := OAuthTestClient("urn:test:user", "")
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	})
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.NotNil(t, auth.Logger(), "expected default logger not to be nil")
+
+	logger := zap.NewExample()
+
+	auth, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithLogger(logger))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.Equal(t, logger, auth.Logger(), "expected configured logger")
+
+	auth, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithLogger(zap.NewNop()), echojwtx.WithLogger(logger))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.Equal(t, logger, auth.Logger(), "expected last configured logger")
+
+	var nilAuth *echojwtx.Auth
+
+	assert.NotNil(t, nilAuth.Logger(), "expected nil auth logger not to be nil")
+}
+
+func TestAudienceClaimPath(t *testing.T) {
+	testCases := []struct {
+		name             string
+		audience         interface{}
+		expectStatusCode int
+	}{
+		{
+			"string audience",
+			"testaud",
+			http.StatusOK,
+		},
+		{
+			"array audience",
+			[]string{"otheraud", "testaud"},
+			http.StatusOK,
+		},
+		{
+			"audience mismatch",
+			"otheraud",
+			http.StatusUnauthorized,
+		},
+		{
+			"missing audience",
+			nil,
+			http.StatusUnauthorized,
+		},
+		{
+			"non string audience",
+			123,
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				client := map[string]interface{}{}
+
+				if tc.audience != nil {
+					client["audience"] = tc.audience
+				}
+
+				return map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+					"aud": "toplevel",
+					"resource_access": map[string]interface{}{
+						"client": client,
+					},
+				}
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer:   issuer,
+					Audience: "testaud",
+				},
+				echojwtx.WithAudienceClaimPath("resource_access.client.audience"),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestInvalidAudienceClaim(t *testing.T) {
+	oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss": issuer,
+			"sub": "urn:test:user",
+			"aud": 123,
+		}
+	})
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer:   issuer,
+			Audience: "testaud",
+		},
+		echojwtx.WithReasonHeader("X-Auth-Reason"),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	resp, err := oauthClient.Get(srv.URL + "/test")
+
+	require.NoError(t, err, "no error expected for request")
+
+	defer resp.Body.Close() //nolint:errcheck // no need to check
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "expected an audience claim which can't be read to be rejected")
+	assert.Equal(t, echojwtx.ReasonInvalidAudience, resp.Header.Get("X-Auth-Reason"), "unexpected reason")
+}
+
+func TestRequireActor(t *testing.T) {
+	testCases := []struct {
+		name             string
+		subject          string
+		expectStatusCode int
+	}{
+		{
+			"actor set",
+			"urn:test:user",
+			http.StatusOK,
+		},
+		{
+			"actor missing",
+			"",
+			http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				claims := map[string]interface{}{
+					"iss": issuer,
+				}
+
+				if tc.subject != "" {
+					claims["sub"] = tc.subject
+				}
+
+				return claims
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			})
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			mdw := func(next echo.HandlerFunc) echo.HandlerFunc {
+				return auth.Middleware()(auth.RequireActor()(next))
+			}
+
+			statusCode := testHelperDoRequest(t, oauthClient, mdw, http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestSubjectClaim(t *testing.T) {
+	testCases := []struct {
+		name             string
+		claims           map[string]interface{}
+		opts             []echojwtx.Opts
+		expectStatusCode int
+		expectActor      string
+	}{
+		{
+			"subject claim present",
+			map[string]interface{}{"sub": "urn:test:sub", "uid": "urn:test:uid"},
+			nil,
+			http.StatusOK,
+			"urn:test:uid",
+		},
+		{
+			"subject claim missing",
+			map[string]interface{}{"sub": "urn:test:sub"},
+			nil,
+			http.StatusForbidden,
+			"",
+		},
+		{
+			"subject claim missing required",
+			map[string]interface{}{"sub": "urn:test:sub"},
+			[]echojwtx.Opts{echojwtx.WithRequireNonEmptySubject(true)},
+			http.StatusUnauthorized,
+			"",
+		},
+	}
+
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, append(tc.opts, echojwtx.WithSubjectClaim("uid"))...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			var actor string
+
+			e := echo.New()
+
+			e.Use(auth.Middleware(), auth.RequireActor())
+
+			e.GET("/test", func(c echo.Context) error {
+				actor = echojwtx.Actor(c)
+
+				return c.NoContent(http.StatusOK)
+			})
+
+			tc.claims["iss"] = issuer
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(tc.claims)))
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+			assert.Equal(t, tc.expectActor, actor, "unexpected actor")
+		})
+	}
+}
+
+func TestNeverReject(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	testCases := []struct {
+		name        string
+		token       string
+		expectActor string
+		expectWarn  int
+	}{
+		{
+			"valid token",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "testaud"}),
+			"urn:test:user",
+			0,
+		},
+		{
+			"invalid claims",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "otheraud"}),
+			"",
+			1,
+		},
+		{
+			"malformed token",
+			"not-a-token",
+			"",
+			1,
+		},
+		{
+			"missing token",
+			"",
+			"",
+			0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer:   issuer,
+				Audience: "testaud",
+			}, echojwtx.WithNeverReject(), echojwtx.WithLogger(zap.New(core)))
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			var (
+				actor string
+				token interface{}
+			)
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				actor = echojwtx.Actor(c)
+				token = c.Get("user")
+
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", tc.token))
+
+			assert.Equal(t, http.StatusOK, rec.Code, "expected 200 response from test server")
+			assert.Equal(t, tc.expectActor, actor, "unexpected actor")
+
+			if tc.expectActor == "" {
+				assert.Nil(t, token, "expected no token for unauthenticated request")
+			}
+
+			warnings := logs.FilterMessage("jwt user rejected, continuing unauthenticated").Len()
+
+			assert.Equal(t, tc.expectWarn, warnings, "unexpected number of rejection warnings")
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	testCases := []struct {
+		name          string
+		token         string
+		expectActor   string
+		expectReasons []string
+	}{
+		{
+			"valid token",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "testaud"}),
+			"urn:test:user",
+			nil,
+		},
+		{
+			"would fail audience",
+			testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "aud": "otheraud"}),
+			"urn:test:user",
+			[]string{echojwtx.ReasonInvalidAudience},
+		},
+		{
+			"malformed token",
+			"not-a-token",
+			"",
+			[]string{echojwtx.ReasonMalformedToken},
+		},
+		{
+			"missing token",
+			"",
+			"",
+			[]string{echojwtx.ReasonMissingToken},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var reasons []string
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer:   issuer,
+				Audience: "testaud",
+			}, echojwtx.WithDryRun(func(_ echo.Context, err error) {
+				reasons = append(reasons, echojwtx.ErrorReason(err))
+			}))
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			var actor string
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				actor = echojwtx.Actor(c)
+
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", tc.token))
+
+			assert.Equal(t, http.StatusOK, rec.Code, "expected 200 response from test server")
+			assert.Equal(t, tc.expectActor, actor, "unexpected actor")
+			assert.Equal(t, tc.expectReasons, reasons, "unexpected dry run reasons")
+		})
+	}
+}
+
+func TestContextWithActor(t *testing.T) {
+	e := echo.New()
+
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/test", nil), httptest.NewRecorder())
+
+	echojwtx.ContextWithActor(c, "urn:test:user")
+
+	assert.Equal(t, "urn:test:user", echojwtx.Actor(c), "unexpected echo context actor")
+	assert.Equal(t, "urn:test:user", c.Request().Context().Value(echojwtx.ActorCtxKey), "unexpected request context actor")
+
+	identity, ok := echojwtx.IdentityFromContext(c.Request().Context())
+	require.True(t, ok, "expected identity in request context")
+
+	assert.Equal(t, "urn:test:user", identity.Subject(), "unexpected identity subject")
+
+	ctx := echojwtx.RequestContextWithActor(context.Background(), "urn:test:other")
+
+	assert.Equal(t, "urn:test:other", ctx.Value(echojwtx.ActorCtxKey), "unexpected context actor")
+}
+
+func TestIssuerHTTPClient(t *testing.T) {
+	oauthClient, issuer, closer := OAuthTestClient("urn:test:user", "")
+	defer closer()
+
+	transport := new(countingTransport)
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: issuer,
+		},
+		echojwtx.WithIssuerHTTPClient("https://other.example.com", http.DefaultClient),
+		echojwtx.WithIssuerHTTPClient(issuer, &http.Client{Transport: transport}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.Equal(t, int32(2), transport.count.Load(), "expected discovery and jwks requests to use issuer client")
+
+	statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+	assert.Equal(t, http.StatusOK, statusCode, "expected 200 response from test server")
+}
+
+func TestAuthenticatedAt(t *testing.T) {
+	testCases := []struct {
+		name   string
+		opts   []echojwtx.Opts
+		expect bool
+	}{
+		{
+			"disabled",
+			nil,
+			false,
+		},
+		{
+			"enabled",
+			[]echojwtx.Opts{echojwtx.WithAuthenticatedAt()},
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := OAuthTestClient("urn:test:user", "")
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, tc.opts...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			var (
+				gotAuthenticatedAt time.Time
+				gotOK              bool
+			)
+
+			before := time.Now()
+
+			mdw := func(next echo.HandlerFunc) echo.HandlerFunc {
+				return auth.Middleware()(func(c echo.Context) error {
+					gotAuthenticatedAt, gotOK = echojwtx.AuthenticatedAt(c.Request().Context())
+
+					return next(c)
+				})
+			}
+
+			statusCode := testHelperDoRequest(t, oauthClient, mdw, http.MethodGet, "/test", nil)
+
+			require.Equal(t, http.StatusOK, statusCode, "expected 200 response from test server")
+
+			assert.Equal(t, tc.expect, gotOK, "unexpected authenticated at presence")
+
+			if tc.expect {
+				assert.WithinRange(t, gotAuthenticatedAt, before, time.Now(), "expected authenticated at during request")
+			}
+		})
+	}
+}
+
+func TestTenantIssuerMap(t *testing.T) {
+	oauthClient, issuer, closer := OAuthTestClient("urn:test:user", "")
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: issuer,
+		},
+		echojwtx.WithTenantIssuerMap("X-Tenant", map[string]string{
+			"tenant-a": issuer,
+			"tenant-b": "https://tenant-b.example.com",
+		}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	testCases := []struct {
+		name             string
+		tenant           string
+		expectStatusCode int
+	}{
+		{
+			"matching tenant",
+			"tenant-a",
+			http.StatusOK,
+		},
+		{
+			"mismatched tenant",
+			"tenant-b",
+			http.StatusForbidden,
+		},
+		{
+			"unknown tenant",
+			"tenant-c",
+			http.StatusForbidden,
+		},
+		{
+			"missing tenant",
+			"",
+			http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			headers := http.Header{}
+
+			if tc.tenant != "" {
+				headers.Set("X-Tenant", tc.tenant)
+			}
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", headers)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestClearContextOnResponse(t *testing.T) {
+	testCases := []struct {
+		name        string
+		opts        []echojwtx.Opts
+		expectActor bool
+	}{
+		{
+			"context retained",
+			nil,
+			true,
+		},
+		{
+			"context cleared",
+			[]echojwtx.Opts{echojwtx.WithClearContextOnResponse()},
+			false,
+		},
+		{
+			"context claims cleared",
+			[]echojwtx.Opts{
+				echojwtx.WithClearContextOnResponse(),
+				echojwtx.WithContextClaims(map[string]string{"sub": "subject"}),
+			},
+			false,
+		},
+		{
+			"enriched logger cleared",
+			[]echojwtx.Opts{
+				echojwtx.WithClearContextOnResponse(),
+				echojwtx.WithLoggerEnrichment("logger"),
+			},
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := OAuthTestClient("urn:test:user", "")
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, tc.opts...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			var (
+				handlerActor  string
+				afterActor    string
+				afterCtxActor interface{}
+				afterToken    interface{}
+				afterSubject  interface{}
+				afterLogger   interface{}
+			)
+
+			mdw := func(next echo.HandlerFunc) echo.HandlerFunc {
+				handler := auth.Middleware()(func(c echo.Context) error {
+					handlerActor = echojwtx.Actor(c)
+
+					return next(c)
+				})
+
+				return func(c echo.Context) error {
+					err := handler(c)
+
+					afterActor = echojwtx.Actor(c)
+					afterCtxActor = c.Request().Context().Value(echojwtx.ActorCtxKey)
+					afterToken = c.Get("user")
+					afterSubject = c.Get("subject")
+					afterLogger = c.Get("logger")
+
+					return err
+				}
+			}
+
+			statusCode := testHelperDoRequest(t, oauthClient, mdw, http.MethodGet, "/test", nil)
+
+			require.Equal(t, http.StatusOK, statusCode, "expected 200 response from test server")
+
+			assert.Equal(t, "urn:test:user", handlerActor, "expected actor during handler")
+
+			if tc.expectActor {
+				assert.Equal(t, "urn:test:user", afterActor, "expected actor after response")
+				assert.NotNil(t, afterCtxActor, "expected context actor after response")
+				assert.NotNil(t, afterToken, "expected token after response")
+			} else {
+				assert.Empty(t, afterActor, "expected actor to be cleared after response")
+				assert.Nil(t, afterCtxActor, "expected context actor to be cleared after response")
+				assert.Nil(t, afterToken, "expected token to be cleared after response")
+				assert.Nil(t, afterSubject, "expected context claims to be cleared after response")
+				assert.Nil(t, afterLogger, "expected enriched logger to be cleared after response")
+			}
+		})
+	}
+}
+
+func TestAudienceQuorum(t *testing.T) {
+	testCases := []struct {
+		name             string
+		audiences        []string
+		expectStatusCode int
+	}{
+		{
+			"all audiences",
+			[]string{"aud1", "aud2", "aud3"},
+			http.StatusOK,
+		},
+		{
+			"exactly quorum",
+			[]string{"aud1", "aud3", "other"},
+			http.StatusOK,
+		},
+		{
+			"below quorum",
+			[]string{"aud2", "other"},
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				return map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+					"aud": tc.audiences,
+				}
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithAudienceQuorum(2, "aud1", "aud2", "aud3"),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+
+	t.Run("invalid quorum", func(t *testing.T) {
+		_, issuer, closer := OAuthTestClient("urn:test:user", "")
+		defer closer()
+
+		_, err := echojwtx.NewAuth(context.Background(),
+			echojwtx.AuthConfig{
+				Issuer: issuer,
+			},
+			echojwtx.WithAudienceQuorum(3, "aud1", "aud2"),
+		)
+
+		assert.ErrorIs(t, err, echojwtx.ErrInvalidAudienceQuorum, "expected invalid quorum error")
+	})
+
+	t.Run("quorum without audiences", func(t *testing.T) {
+		_, issuer, closer := OAuthTestClient("urn:test:user", "")
+		defer closer()
+
+		for _, n := range []int{2, -1} {
+			_, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithAudienceQuorum(n),
+			)
+
+			assert.ErrorIsf(t, err, echojwtx.ErrInvalidAudienceQuorum, "expected invalid quorum error for quorum %d", n)
+		}
+	})
+}
+
+func TestRouteLogging(t *testing.T) {
+	oauthClient, issuer, closer := OAuthTestClient("urn:test:user", "testaud")
+	defer closer()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer:   issuer,
+			Audience: "otheraud",
+		},
+		echojwtx.WithLogger(zap.New(core)),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.GET("/items/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, auth.Middleware())
+
+	srv := httptest.NewServer(e)
+
+	defer srv.Close()
+
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, srv.URL+"/items/1234", nil)
+
+	require.NoError(t, err, "expected new request without error")
+
+	resp, err := oauthClient.Do(req)
+
+	require.NoError(t, err, "expected response without error")
+
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "expected 401 response from test server")
+
+	entries := logs.FilterMessage("jwt user claim invalid audience").All()
+
+	require.Len(t, entries, 1, "expected invalid audience log entry")
+
+	assert.Equal(t, "/items/:id", entries[0].ContextMap()["route"], "expected route pattern in log entry")
+}
+
+func TestContextClaims(t *testing.T) {
+	oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss":    issuer,
+			"sub":    "urn:test:user",
+			"tenant": "tenant-a",
+		}
+	})
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: issuer,
+		},
+		echojwtx.WithContextClaims(map[string]string{
+			"tenant": "tenant",
+			"region": "region",
+		}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	var (
+		gotTenant interface{}
+		gotRegion interface{}
+		gotActor  string
+	)
+
+	mdw := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return auth.Middleware()(func(c echo.Context) error {
+			gotTenant = c.Get("tenant")
+			gotRegion = c.Get("region")
+			gotActor = echojwtx.Actor(c)
+
+			return next(c)
+		})
+	}
+
+	statusCode := testHelperDoRequest(t, oauthClient, mdw, http.MethodGet, "/test", nil)
+
+	require.Equal(t, http.StatusOK, statusCode, "expected 200 response from test server")
+
+	assert.Equal(t, "tenant-a", gotTenant, "expected tenant claim in context")
+	assert.Nil(t, gotRegion, "expected missing region claim not to be set")
+	assert.Equal(t, "urn:test:user", gotActor, "expected actor to still be set")
+}
+
+func TestSubjectValidator(t *testing.T) {
+	errInvalidSubject := errors.New("subject is not a urn")
+
+	validator := func(sub string) error {
+		if !strings.HasPrefix(sub, "urn:") {
+			return errInvalidSubject
+		}
+
+		return nil
+	}
+
+	testCases := []struct {
+		name             string
+		subject          string
+		expectStatusCode int
+	}{
+		{
+			"valid subject",
+			"urn:test:user",
+			http.StatusOK,
+		},
+		{
+			"invalid subject",
+			"user@example.com",
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := OAuthTestClient(tc.subject, "")
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithSubjectValidator(validator),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestRequireNonEmptySubject(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	testCases := []struct {
+		name             string
+		claims           map[string]interface{}
+		enabled          bool
+		expectStatusCode int
+	}{
+		{
+			"subject",
+			map[string]interface{}{"sub": "urn:test:user"},
+			true,
+			http.StatusOK,
+		},
+		{
+			"empty subject",
+			map[string]interface{}{"sub": ""},
+			true,
+			http.StatusUnauthorized,
+		},
+		{
+			"missing subject",
+			map[string]interface{}{},
+			true,
+			http.StatusUnauthorized,
+		},
+		{
+			"empty subject not required",
+			map[string]interface{}{"sub": ""},
+			false,
+			http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithRequireNonEmptySubject(tc.enabled),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			tc.claims["iss"] = issuer
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(tc.claims)))
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestClaimValidator(t *testing.T) {
+	activeTenants := map[string]bool{"tenant-a": true}
+
+	tenantActive := func(_ context.Context, claims jwt.MapClaims) error {
+		if tenant, _ := claims["tenant"].(string); !activeTenants[tenant] {
+			return errors.New("tenant not active")
+		}
+
+		return nil
+	}
+
+	paymentRequired := func(_ context.Context, claims jwt.MapClaims) error {
+		if claims["plan"] != "paid" {
+			return echo.NewHTTPError(http.StatusPaymentRequired, "plan required")
+		}
+
+		return nil
+	}
+
+	testCases := []struct {
+		name             string
+		claims           map[string]interface{}
+		expectStatusCode int
+	}{
+		{
+			"pass",
+			map[string]interface{}{"tenant": "tenant-a", "plan": "paid"},
+			http.StatusOK,
+		},
+		{
+			"first validator fails",
+			map[string]interface{}{"tenant": "tenant-b"},
+			http.StatusForbidden,
+		},
+		{
+			"validator sets status",
+			map[string]interface{}{"tenant": "tenant-a"},
+			http.StatusPaymentRequired,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				claims := map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+				}
+
+				for key, value := range tc.claims {
+					claims[key] = value
+				}
+
+				return claims
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, echojwtx.WithClaimValidator(tenantActive), echojwtx.WithClaimValidator(paymentRequired))
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestLoggerEnrichment(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	core, logs := observer.New(zapcore.InfoLevel)
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithLoggerEnrichment("logger"))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	// request logging middleware storing a request scoped logger.
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("logger", zap.New(core).With(zap.String("request_id", "req-1")))
+
+			return next(c)
+		}
+	})
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		c.Get("logger").(*zap.Logger).Info("handled request")
+
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+		"iss":   issuer,
+		"sub":   "urn:test:user",
+		"email": "user@example.com",
+	})))
+
+	require.Equal(t, http.StatusOK, rec.Code, "expected 200 response from test server")
+
+	entries := logs.FilterMessage("handled request").All()
+
+	require.Len(t, entries, 1, "expected handler log entry")
+
+	assert.Equal(t, map[string]interface{}{
+		"request_id": "req-1",
+		"subject":    "urn:test:user",
+		"issuer":     issuer,
+	}, entries[0].ContextMap(), "unexpected log fields")
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+)
+
+// infraError is an infrastructure failure and the time it occurred.
+type infraError struct {
+	err error
+	at  time.Time
+}
+
+// LastInfraError returns the last infrastructure failure and the time it occurred, such as a failed discovery or
+// JWKS refresh or a request which couldn't be validated because the keys were unavailable. Invalid tokens sent by
+// clients are not infrastructure failures. JWKS failures are cleared by the next successful JWKS refresh, once the
+// keys were fetched and parsed, and discovery failures by the next successful discovery, so a nil error means
+// validation isn't currently degraded, which allows health checks to report the state of authentication.
+func (a *Auth) LastInfraError() (error, time.Time) { //nolint:revive
+	last := a.lastInfraError.Load()
+
+	if discovery := a.lastDiscoveryError.Load(); discovery != nil && (last == nil || discovery.at.After(last.at)) {
+		last = discovery
+	}
+
+	if last == nil {
+		return nil, time.Time{}
+	}
+
+	return last.err, last.at
+}
+
+// recordInfraError records an infrastructure failure of the JWKS.
+func (a *Auth) recordInfraError(err error) {
+	a.lastInfraError.Store(&infraError{err: err, at: a.now()})
+}
+
+// clearInfraError clears the last JWKS failure after a successful refresh.
+func (a *Auth) clearInfraError() {
+	a.lastInfraError.Store(nil)
+}
+
+// recordDiscoveryError records a failed oidc discovery.
+func (a *Auth) recordDiscoveryError(err error) {
+	a.lastDiscoveryError.Store(&infraError{err: err, at: a.now()})
+}
+
+// clearDiscoveryError clears the last discovery failure after a successful discovery. JWKS failures are kept.
+func (a *Auth) clearDiscoveryError() {
+	a.lastDiscoveryError.Store(nil)
+}
+
+// infraRefreshErrorHandler wraps the JWKS refresh error handler to record refresh failures.
+func (a *Auth) infraRefreshErrorHandler(handler func(err error)) func(err error) {
+	return func(err error) {
+		a.recordInfraError(err)
+
+		handler(err)
+	}
+}
+
+// infraResponseExtractor wraps the JWKS response extractor to clear the last failure after a successful refresh.
+// The extracted JWKS is parsed first, as keyfunc only reports parse failures to the refresh error handler.
+func (a *Auth) infraResponseExtractor(extractor func(ctx context.Context, resp *http.Response) (json.RawMessage, error)) func(ctx context.Context, resp *http.Response) (json.RawMessage, error) {
+	if extractor == nil {
+		extractor = keyfunc.ResponseExtractorStatusOK
+	}
+
+	return func(ctx context.Context, resp *http.Response) (json.RawMessage, error) {
+		raw, err := extractor(ctx, resp)
+		if err != nil {
+			return raw, err
+		}
+
+		if _, err := keyfunc.NewJSON(raw); err == nil {
+			a.clearInfraError()
+		}
+
+		return raw, nil
+	}
+}
@@ -0,0 +1,96 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestLastInfraError(t *testing.T) {
+	var down, malformed atomic.Bool
+
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"issuer": srv.URL, "jwks_uri": srv.URL + "/jwks.json"})
+	})
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		if down.Load() {
+			return c.NoContent(http.StatusServiceUnavailable)
+		}
+
+		if malformed.Load() {
+			return c.String(http.StatusOK, "not a jwks")
+		}
+
+		return c.JSON(http.StatusOK, testHelperJoseJWKSProvider(TestPrivRSAKey1ID))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	auth, err := echojwtx.NewAuth(ctx, echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	}, echojwtx.WithKeyFuncOptions(keyfunc.Options{
+		RefreshInterval:  10 * time.Millisecond,
+		RefreshRateLimit: time.Millisecond,
+	}), echojwtx.WithDiscoveryRefreshInterval(10*time.Millisecond))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	router := echo.New()
+
+	router.Use(auth.Middleware())
+
+	router.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", "not-a-token"))
+
+	require.Equal(t, http.StatusUnauthorized, rec.Code, "expected invalid token to be rejected")
+
+	lastErr, _ := auth.LastInfraError()
+	assert.NoError(t, lastErr, "expected client errors not to be recorded")
+
+	down.Store(true)
+
+	require.Eventually(t, func() bool {
+		lastErr, at := auth.LastInfraError()
+
+		return lastErr != nil && !at.IsZero()
+	}, time.Second, 10*time.Millisecond, "expected jwks refresh failure to be recorded")
+
+	malformed.Store(true)
+	down.Store(false)
+
+	assert.Never(t, func() bool {
+		lastErr, _ := auth.LastInfraError()
+
+		return lastErr == nil
+	}, 100*time.Millisecond, 10*time.Millisecond, "expected failure to be kept while the jwks can't be parsed")
+
+	malformed.Store(false)
+
+	require.Eventually(t, func() bool {
+		lastErr, _ := auth.LastInfraError()
+
+		return lastErr == nil
+	}, time.Second, 10*time.Millisecond, "expected successful jwks refresh to clear the failure")
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HTTPMiddleware returns net/http middleware for validating jwt tokens, compatible with routers such as chi.
+// Validation is the same as Middleware and the actor is stored in the request context under ActorCtxKey.
+// Rejected requests are rendered with echo's default HTTP error handler.
+func (a *Auth) HTTPMiddleware() func(http.Handler) http.Handler {
+	e := echo.New()
+	mdw := a.Middleware()
+
+	return func(next http.Handler) http.Handler {
+		handler := mdw(func(c echo.Context) error {
+			next.ServeHTTP(c.Response(), c.Request())
+
+			return nil
+		})
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := e.NewContext(r, w)
+
+			if err := handler(c); err != nil {
+				e.HTTPErrorHandler(err, c)
+			}
+		})
+	}
+}
+
+// NewHTTPJWTAuth creates a new net/http middleware for JWTs using JWKS.
+// See HTTPMiddleware.
+func NewHTTPJWTAuth(ctx context.Context, config AuthConfig, options ...Opts) (func(http.Handler) http.Handler, error) {
+	auth, err := NewAuth(ctx, config, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.HTTPMiddleware(), nil
+}
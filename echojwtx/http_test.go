@@ -0,0 +1,105 @@
+package echojwtx_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestNewHTTPJWTAuth(t *testing.T) {
+	testCases := []struct {
+		name             string
+		authenticated    bool
+		expectStatusCode int
+		expectActor      string
+	}{
+		{
+			"authenticated",
+			true,
+			http.StatusOK,
+			"urn:test:user",
+		},
+		{
+			"unauthenticated",
+			false,
+			http.StatusUnauthorized,
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := OAuthTestClient("urn:test:user", "")
+			defer closer()
+
+			if !tc.authenticated {
+				oauthClient = http.DefaultClient
+			}
+
+			authMiddleware, err := echojwtx.NewHTTPJWTAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			})
+
+			require.NoError(t, err, "no error expected for NewHTTPJWTAuth")
+
+			var gotActor string
+
+			srv := httptest.NewServer(authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotActor, _ = r.Context().Value(echojwtx.ActorCtxKey).(string)
+
+				w.WriteHeader(http.StatusOK)
+			})))
+
+			defer srv.Close()
+
+			req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, srv.URL+"/test", nil)
+
+			require.NoError(t, err, "expected new request without error")
+
+			resp, err := oauthClient.Do(req)
+
+			require.NoError(t, err, "expected response without error")
+
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tc.expectStatusCode, resp.StatusCode, "unexpected response status")
+			assert.Equal(t, tc.expectActor, gotActor, "unexpected actor")
+		})
+	}
+}
+
+// This example uses a net/http mux. The middleware is a func(http.Handler) http.Handler, the signature chi's
+// Router.Use accepts, so with chi it is registered with r.Use(authMiddleware).
+func ExampleNewHTTPJWTAuth() {
+	_, issuer, closer := OAuthTestClient("urn:test:user", "")
+	defer closer()
+
+	authMiddleware, err := echojwtx.NewHTTPJWTAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.Handle("/whoami", authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, _ := r.Context().Value(echojwtx.ActorCtxKey).(string)
+
+		fmt.Fprintln(w, actor)
+	})))
+
+	rec := httptest.NewRecorder()
+
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/whoami", nil))
+
+	fmt.Println(rec.Code)
+	// Output: 401
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/exp/slices"
+)
+
+// Identity describes the authenticated principal of a request independent of the token format.
+type Identity interface {
+	// Subject returns the token subject.
+	Subject() string
+
+	// HasScope returns true if the token was granted the provided scope.
+	HasScope(scope string) bool
+
+	// HasRole returns true if the token contains the provided role.
+	HasRole(role string) bool
+
+	// Claim returns the raw value of the provided claim and whether it was present.
+	Claim(name string) (interface{}, bool)
+}
+
+// claimsIdentity implements Identity over validated token claims.
+type claimsIdentity struct {
+	claims  jwt.MapClaims
+	subject string
+	scopes  []string
+	roles   []string
+}
+
+// newClaimsIdentity returns an Identity for the provided claims, subject and granted scopes.
+// Roles are read from the roles claim.
+func newClaimsIdentity(claims jwt.MapClaims, subject string, scopes []string) *claimsIdentity {
+	roles, _ := claimStrings(claims["roles"])
+
+	return &claimsIdentity{
+		claims:  claims,
+		subject: subject,
+		scopes:  scopes,
+		roles:   roles,
+	}
+}
+
+// Subject implements Identity.
+func (i *claimsIdentity) Subject() string {
+	return i.subject
+}
+
+// HasScope implements Identity.
+func (i *claimsIdentity) HasScope(scope string) bool {
+	return slices.Contains(i.scopes, scope)
+}
+
+// HasRole implements Identity.
+func (i *claimsIdentity) HasRole(role string) bool {
+	return slices.Contains(i.roles, role)
+}
+
+// Claim implements Identity.
+func (i *claimsIdentity) Claim(name string) (interface{}, bool) {
+	value, ok := i.claims[name]
+
+	return value, ok
+}
+
+// IdentityFromContext retrieves the Identity of the authenticated request from the context.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityContext{}).(Identity)
+
+	return identity, ok
+}
@@ -0,0 +1,99 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestIdentityFromContext(t *testing.T) {
+	testCases := []struct {
+		name        string
+		claims      map[string]interface{}
+		expectScope bool
+		expectRole  bool
+	}{
+		{
+			"scope claim",
+			map[string]interface{}{"scope": "read write", "roles": []string{"admin"}},
+			true,
+			true,
+		},
+		{
+			"scp claim",
+			map[string]interface{}{"scp": []string{"read", "write"}, "roles": "admin"},
+			true,
+			true,
+		},
+		{
+			"no scopes or roles",
+			map[string]interface{}{},
+			false,
+			false,
+		},
+	}
+
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	})
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				identity echojwtx.Identity
+				found    bool
+			)
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				identity, found = echojwtx.IdentityFromContext(c.Request().Context())
+
+				return c.NoContent(http.StatusOK)
+			})
+
+			claims := map[string]interface{}{
+				"iss":    issuer,
+				"sub":    "urn:test:user",
+				"custom": "value",
+			}
+
+			for key, value := range tc.claims {
+				claims[key] = value
+			}
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(claims)))
+
+			require.Equal(t, http.StatusOK, rec.Code, "expected 200 response from test server")
+			require.True(t, found, "expected identity in context")
+
+			assert.Equal(t, "urn:test:user", identity.Subject(), "unexpected subject")
+			assert.Equal(t, tc.expectScope, identity.HasScope("write"), "unexpected scope result")
+			assert.False(t, identity.HasScope("delete"), "expected missing scope")
+			assert.Equal(t, tc.expectRole, identity.HasRole("admin"), "unexpected role result")
+
+			value, ok := identity.Claim("custom")
+			assert.True(t, ok, "expected custom claim")
+			assert.Equal(t, "value", value, "unexpected custom claim")
+		})
+	}
+
+	_, found := echojwtx.IdentityFromContext(context.Background())
+	assert.False(t, found, "expected no identity in empty context")
+}
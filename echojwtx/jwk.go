@@ -0,0 +1,177 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+	"gopkg.in/square/go-jose.v2"
+)
+
+var (
+	errEmbeddedJWKInvalid    = errors.New("embedded jwk is not a public asymmetric key")
+	errCertificateNotTrusted = errors.New("token certificate thumbprint is not trusted")
+)
+
+// WithAcceptEmbeddedJWK accepts tokens signed by the key embedded in the token's jwk header when the configured
+// keys can't validate the token and trustFn approves the token.
+//
+// An embedded key is chosen by whoever created the token, so without a strict trustFn any party can mint a
+// token which validates. trustFn must establish trust in the embedded key itself, for example by comparing its
+// thumbprint against known keys, and should never approve tokens based on their claims alone. This option is
+// intended for DPoP-bound or development tokens and should not be used to authenticate general traffic.
+// Only public asymmetric keys are accepted.
+func WithAcceptEmbeddedJWK(trustFn func(*jwt.Token) bool) Opts {
+	return func(a *Auth) {
+		a.trustEmbeddedJWK = trustFn
+	}
+}
+
+// embeddedJWKKeyfunc wraps the provided keyfunc, returning the token's embedded jwk when the keyfunc fails to
+// resolve a key and the embedded key is trusted.
+func (a *Auth) embeddedJWKKeyfunc(next jwt.Keyfunc) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		key, err := next(token)
+		if err == nil {
+			return key, nil
+		}
+
+		raw, ok := token.Header["jwk"]
+		if !ok || !a.trustEmbeddedJWK(token) {
+			return nil, err
+		}
+
+		embedded, jwkErr := embeddedJWK(raw)
+		if jwkErr != nil {
+			return nil, errors.Join(err, jwkErr)
+		}
+
+		return embedded, nil
+	}
+}
+
+// embeddedJWK parses a jwk header value, returning the public key.
+func embeddedJWK(raw interface{}) (interface{}, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwk jose.JSONWebKey
+
+	if err := jwk.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+
+	if !jwk.Valid() || !jwk.IsPublic() {
+		return nil, errEmbeddedJWKInvalid
+	}
+
+	if _, ok := jwk.Key.([]byte); ok {
+		return nil, errEmbeddedJWKInvalid
+	}
+
+	return jwk.Key, nil
+}
+
+// WithTrustedKeyThumbprints accepts tokens signed by a key whose certificate is embedded in the token's x5c header
+// when the JWKS is unavailable, such as when a refresh failed, timed out or the circuit breaker is open, and the
+// certificate's x5t#S256 thumbprint, the unpadded base64url encoded SHA-256 digest of the DER certificate, is one
+// of the provided thumbprints. Tokens with a key id unknown to a healthy JWKS are rejected. The certificate must be
+// within its validity period, it is not otherwise verified.
+//
+// Trusted thumbprints bypass the issuer's JWKS entirely, a key removed from the JWKS after being compromised or
+// revoked is still accepted until the thumbprint is removed from the configuration. Only thumbprints of keys which
+// remain trusted for the lifetime of the deployment should be configured, and the list must be maintained
+// alongside the issuer's key rotations. This option is intended as a last resort to keep validating tokens
+// signed by pre-trusted keys while the issuer is unavailable.
+func WithTrustedKeyThumbprints(thumbprints ...string) Opts {
+	return func(a *Auth) {
+		a.trustedThumbprints = thumbprints
+	}
+}
+
+// trustedThumbprintKeyfunc wraps the provided keyfunc, returning the public key of the token's x5c certificate
+// when the keyfunc fails to resolve a key because the JWKS is unavailable and the certificate thumbprint is trusted.
+func (a *Auth) trustedThumbprintKeyfunc(next jwt.Keyfunc) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		key, err := next(token)
+		if err == nil || !a.jwksOutage(err) {
+			return key, err
+		}
+
+		raw, ok := token.Header["x5c"]
+		if !ok {
+			return nil, err
+		}
+
+		cert, certErr := a.trustedCertificate(raw)
+		if certErr != nil {
+			return nil, errors.Join(err, certErr)
+		}
+
+		a.logger.Warn("jwt user token validated by trusted certificate thumbprint", zap.Error(err))
+
+		return cert.PublicKey, nil
+	}
+}
+
+// jwksOutage returns true if err was caused by the JWKS being unavailable, rather than the token's key being unknown
+// to a healthy JWKS.
+func (a *Auth) jwksOutage(err error) bool {
+	if errors.Is(err, ErrJWKSRefreshTimeout) || errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+
+	return a.lastInfraError.Load() != nil
+}
+
+// trustedCertificate parses the leaf certificate of an x5c header value, returning it if its thumbprint is
+// trusted and it is within its validity period.
+func (a *Auth) trustedCertificate(raw interface{}) (*x509.Certificate, error) {
+	chain, err := claimStrings(raw)
+	if err != nil || len(chain) == 0 {
+		return nil, errCertificateNotTrusted
+	}
+
+	der, err := base64.StdEncoding.DecodeString(chain[0])
+	if err != nil {
+		return nil, errCertificateNotTrusted
+	}
+
+	sum := sha256.Sum256(der)
+
+	if !slices.Contains(a.trustedThumbprints, base64.RawURLEncoding.EncodeToString(sum[:])) {
+		return nil, errCertificateNotTrusted
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errCertificateNotTrusted
+	}
+
+	if now := a.now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, errCertificateNotTrusted
+	}
+
+	return cert, nil
+}
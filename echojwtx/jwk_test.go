@@ -0,0 +1,177 @@
+package echojwtx_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestAcceptEmbeddedJWK(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	embeddedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	require.NoError(t, err, "no error expected generating key")
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: embeddedKey}, (&jose.SignerOptions{EmbedJWK: true}).WithType("JWT"))
+
+	require.NoError(t, err, "no error expected creating signer")
+
+	token, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Issuer:  issuer,
+		Subject: "urn:test:user",
+	}).CompactSerialize()
+
+	require.NoError(t, err, "no error expected signing token")
+
+	testCases := []struct {
+		name             string
+		opts             []echojwtx.Opts
+		expectStatusCode int
+	}{
+		{
+			"embedded jwk not accepted",
+			nil,
+			http.StatusUnauthorized,
+		},
+		{
+			"embedded jwk untrusted",
+			[]echojwtx.Opts{echojwtx.WithAcceptEmbeddedJWK(func(*gojwt.Token) bool { return false })},
+			http.StatusUnauthorized,
+		},
+		{
+			"embedded jwk trusted",
+			[]echojwtx.Opts{echojwtx.WithAcceptEmbeddedJWK(func(*gojwt.Token) bool { return true })},
+			http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, tc.opts...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, http.DefaultClient, auth.Middleware(), http.MethodGet, "/test", http.Header{
+				echo.HeaderAuthorization: []string{"Bearer " + token},
+			})
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestTrustedKeyThumbprints(t *testing.T) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "issuer signing key"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &TestPrivRSAKey2.PublicKey, TestPrivRSAKey2)
+
+	require.NoError(t, err, "no error expected creating certificate")
+
+	sum := sha256.Sum256(der)
+	thumbprint := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	testCases := []struct {
+		name             string
+		opts             []echojwtx.Opts
+		jwksAvailable    bool
+		expectStatusCode int
+	}{
+		{
+			"thumbprints not configured",
+			nil,
+			false,
+			http.StatusUnauthorized,
+		},
+		{
+			"thumbprint not trusted",
+			[]echojwtx.Opts{echojwtx.WithTrustedKeyThumbprints("bm90LXRydXN0ZWQ")},
+			false,
+			http.StatusUnauthorized,
+		},
+		{
+			"thumbprint trusted",
+			[]echojwtx.Opts{echojwtx.WithTrustedKeyThumbprints("bm90LXRydXN0ZWQ", thumbprint)},
+			false,
+			http.StatusOK,
+		},
+		{
+			"thumbprint trusted unknown key jwks available",
+			[]echojwtx.Opts{echojwtx.WithTrustedKeyThumbprints(thumbprint)},
+			true,
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, tc.opts...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			if tc.jwksAvailable {
+				defer closer()
+			} else {
+				// take the jwks down so the unknown key can't be refreshed.
+				closer()
+			}
+
+			token := gojwt.NewWithClaims(gojwt.SigningMethodRS256, gojwt.MapClaims{
+				"iss": issuer,
+				"sub": "urn:test:user",
+			})
+
+			token.Header["kid"] = TestPrivRSAKey2ID
+			token.Header["x5c"] = []string{base64.StdEncoding.EncodeToString(der)}
+
+			signed, err := token.SignedString(TestPrivRSAKey2)
+
+			require.NoError(t, err, "no error expected signing token")
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", signed))
+
+			assert.Equal(t, tc.expectStatusCode, rec.Code, "unexpected status code")
+		})
+	}
+}
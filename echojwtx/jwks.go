@@ -0,0 +1,242 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/exp/slices"
+)
+
+// ErrJWKSRefreshTimeout is returned when a JWKS refresh triggered by a request exceeds the refresh timeout.
+var ErrJWKSRefreshTimeout = errors.New("jwks refresh timed out")
+
+// WithStandbyJWKSURI sets a standby JWKS which is only consulted when the primary JWKS, the discovered JWKS and
+// any additional JWKS, can't resolve a token's key id, including when the primary JWKS is unreachable. Unlike
+// WithAdditionalJWKSURIs, keys are always resolved from the primary JWKS first and the standby only takes over
+// on failure. The standby must be reachable when NewAuth is called, while the primary JWKS may be unavailable
+// and is refreshed in the background until it recovers. With WithCircuitBreaker, the standby has its own breaker
+// so it keeps refreshing while the primary's breaker is open.
+func WithStandbyJWKSURI(uri string) Opts {
+	return func(a *Auth) {
+		a.standbyJWKSURI = uri
+	}
+}
+
+// WithRefreshTimeout limits how long a request waits on a JWKS refresh triggered by a token with an unknown key
+// id. Requests whose refresh exceeds the timeout are rejected with a 503, bounding request latency while the
+// issuer is slow during key rollover. The refresh itself continues in the background.
+//
+// This differs from AuthConfig.RefreshTimeout, which limits every JWKS fetch including the periodic refreshes.
+func WithRefreshTimeout(d time.Duration) Opts {
+	return func(a *Auth) {
+		a.syncRefreshTimeout = d
+	}
+}
+
+// jwksRefresh is a refresh of the JWKS which is in flight.
+type jwksRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// jwksKeyfunc wraps one or more JWKS, refreshing them when a token has a key id not found in any of them.
+// Concurrent refreshes are coalesced so at most one refresh is in flight, with all callers waiting on its result.
+type jwksKeyfunc struct {
+	ctx  context.Context
+	sets atomic.Pointer[[]*keyfunc.JWKS]
+
+	refreshUnknownKID bool
+	refreshTimeout    time.Duration
+	breaker           *circuitBreaker
+	metrics           *jwksMetrics
+
+	standby *keyfunc.JWKS
+
+	mu       sync.Mutex
+	inflight *jwksRefresh
+}
+
+// Keyfunc implements jwt.Keyfunc.
+// The standby JWKS, if set, resolves the key when the primary JWKS can't.
+func (k *jwksKeyfunc) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key, err := k.primaryKeyfunc(token)
+	if k.standby == nil || !standbyError(err) {
+		return key, err
+	}
+
+	return k.standby.Keyfunc(token)
+}
+
+// standbyError returns true if err indicates the primary JWKS couldn't resolve the token's key.
+func standbyError(err error) bool {
+	return errors.Is(err, keyfunc.ErrKIDNotFound) || errors.Is(err, ErrJWKSRefreshTimeout) || errors.Is(err, ErrCircuitOpen)
+}
+
+// primaryKeyfunc resolves the token's key from the primary JWKS, refreshing them for unknown key ids if enabled.
+func (k *jwksKeyfunc) primaryKeyfunc(token *jwt.Token) (interface{}, error) {
+	key, err := k.lookup(token)
+	if err == nil {
+		k.metrics.cacheHit()
+	}
+
+	if !k.refreshUnknownKID || !errors.Is(err, keyfunc.ErrKIDNotFound) {
+		return key, err
+	}
+
+	if !k.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	if err := k.refresh(); err != nil {
+		return nil, err
+	}
+
+	return k.lookup(token)
+}
+
+// lookup returns the key for the token from the first JWKS which has the token's key id.
+func (k *jwksKeyfunc) lookup(token *jwt.Token) (interface{}, error) {
+	for _, jwks := range k.keySets() {
+		key, err := jwks.Keyfunc(token)
+		if !errors.Is(err, keyfunc.ErrKIDNotFound) {
+			return key, err
+		}
+	}
+
+	return nil, keyfunc.ErrKIDNotFound
+}
+
+// refresh refreshes the JWKS, waiting on any refresh already in flight instead of starting a new one.
+// Refreshes are still subject to the configured refresh rate limit.
+func (k *jwksKeyfunc) refresh() error {
+	k.mu.Lock()
+
+	if call := k.inflight; call != nil {
+		k.mu.Unlock()
+
+		<-call.done
+
+		return call.err
+	}
+
+	call := &jwksRefresh{
+		done: make(chan struct{}),
+	}
+
+	k.inflight = call
+
+	k.mu.Unlock()
+
+	k.metrics.forcedRefresh()
+
+	ctx := k.ctx
+
+	if k.refreshTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, k.refreshTimeout)
+		defer cancel()
+	}
+
+	sets := k.keySets()
+
+	errs := make([]error, 0, len(sets))
+
+	for _, jwks := range sets {
+		errs = append(errs, jwks.Refresh(ctx, keyfunc.RefreshOptions{}))
+	}
+
+	call.err = errors.Join(errs...)
+
+	if k.refreshTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		call.err = fmt.Errorf("%w: %w", ErrJWKSRefreshTimeout, call.err)
+	}
+
+	k.mu.Lock()
+	k.inflight = nil
+	k.mu.Unlock()
+
+	close(call.done)
+
+	return call.err
+}
+
+// keySets returns the current JWKS.
+func (k *jwksKeyfunc) keySets() []*keyfunc.JWKS {
+	if sets := k.sets.Load(); sets != nil {
+		return *sets
+	}
+
+	return nil
+}
+
+// replacePrimary atomically replaces the JWKS found by discovery, the first set, and returns the replaced set.
+func (k *jwksKeyfunc) replacePrimary(jwks *keyfunc.JWKS) *keyfunc.JWKS {
+	for {
+		current := k.sets.Load()
+
+		sets := append([]*keyfunc.JWKS{jwks}, (*current)[1:]...)
+
+		if k.sets.CompareAndSwap(current, &sets) {
+			return (*current)[0]
+		}
+	}
+}
+
+// keyCount returns the number of keys loaded across all sets.
+func (k *jwksKeyfunc) keyCount() int {
+	var count int
+
+	for _, jwks := range k.keySets() {
+		count += jwks.Len()
+	}
+
+	return count
+}
+
+// algorithms returns the distinct algorithms advertised by the keys of all sets.
+func (k *jwksKeyfunc) algorithms() []string {
+	var algorithms []string
+
+	for _, jwks := range k.keySets() {
+		// only the alg is decoded so keys of types go-jose doesn't support don't fail the whole set.
+		var set struct {
+			Keys []struct {
+				Algorithm string `json:"alg"`
+			} `json:"keys"`
+		}
+
+		if err := json.Unmarshal(jwks.RawJWKS(), &set); err != nil {
+			continue
+		}
+
+		for _, key := range set.Keys {
+			if key.Algorithm != "" && !slices.Contains(algorithms, key.Algorithm) {
+				algorithms = append(algorithms, key.Algorithm)
+			}
+		}
+	}
+
+	return algorithms
+}
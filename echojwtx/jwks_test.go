@@ -0,0 +1,403 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestConcurrentUnknownKIDRefresh(t *testing.T) {
+	provider := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer provider.Close()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: provider.issuer,
+	})
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	require.Equal(t, int32(1), provider.jwksRequests.Load(), "expected initial jwks request")
+
+	provider.SetKeyIDs(TestPrivRSAKey1ID, TestPrivRSAKey2ID)
+
+	signer := testHelperMustMakeSigner(jose.RS256, TestPrivRSAKey2ID, TestPrivRSAKey2)
+
+	token, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Issuer:  provider.issuer,
+		Subject: "urn:test:user",
+	}).CompactSerialize()
+
+	require.NoError(t, err, "no error expected signing token")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	const requests = 50
+
+	var wg sync.WaitGroup
+
+	statusCodes := make(chan int, requests)
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			req := testHelperRequest(http.MethodGet, "/test", token)
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			statusCodes <- rec.Code
+		}()
+	}
+
+	wg.Wait()
+	close(statusCodes)
+
+	for statusCode := range statusCodes {
+		assert.Equal(t, http.StatusOK, statusCode, "expected 200 response")
+	}
+
+	assert.Equal(t, int32(2), provider.jwksRequests.Load(), "expected a single jwks refresh")
+}
+
+func TestAdditionalJWKSURIs(t *testing.T) {
+	provider := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer provider.Close()
+
+	nextProvider := newTestOIDCProvider(TestPrivRSAKey2ID)
+	defer nextProvider.Close()
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: provider.issuer,
+		},
+		echojwtx.WithAdditionalJWKSURIs(provider.issuer, nextProvider.issuer+"/.well-known/jwks.json"),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	testCases := []struct {
+		name   string
+		keyID  string
+		key    interface{}
+		status int
+	}{
+		{
+			"discovered jwks key",
+			TestPrivRSAKey1ID,
+			TestPrivRSAKey1,
+			http.StatusOK,
+		},
+		{
+			"additional jwks key",
+			TestPrivRSAKey2ID,
+			TestPrivRSAKey2,
+			http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			signer := testHelperMustMakeSigner(jose.RS256, tc.keyID, tc.key)
+
+			token, err := jwt.Signed(signer).Claims(jwt.Claims{
+				Issuer:  provider.issuer,
+				Subject: "urn:test:user",
+			}).CompactSerialize()
+
+			require.NoError(t, err, "no error expected signing token")
+
+			statusCode := testHelperDoRequest(t, http.DefaultClient, auth.Middleware(), http.MethodGet, "/test", http.Header{
+				echo.HeaderAuthorization: []string{"Bearer " + token},
+			})
+
+			assert.Equal(t, tc.status, statusCode, "unexpected response status")
+		})
+	}
+}
+
+func TestRefreshOnUnknownKID(t *testing.T) {
+	testCases := []struct {
+		name             string
+		opts             []echojwtx.Opts
+		expectStatusCode int
+	}{
+		{
+			"default refresh",
+			nil,
+			http.StatusOK,
+		},
+		{
+			"refresh enabled",
+			[]echojwtx.Opts{echojwtx.WithRefreshOnUnknownKID(true)},
+			http.StatusOK,
+		},
+		{
+			"refresh disabled",
+			[]echojwtx.Opts{echojwtx.WithRefreshOnUnknownKID(false)},
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := newTestOIDCProvider(TestPrivRSAKey1ID)
+			defer provider.Close()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: provider.issuer,
+			}, tc.opts...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			provider.SetKeyIDs(TestPrivRSAKey1ID, TestPrivRSAKey2ID)
+
+			signer := testHelperMustMakeSigner(jose.RS256, TestPrivRSAKey2ID, TestPrivRSAKey2)
+
+			token, err := jwt.Signed(signer).Claims(jwt.Claims{
+				Issuer:  provider.issuer,
+				Subject: "urn:test:user",
+			}).CompactSerialize()
+
+			require.NoError(t, err, "no error expected signing token")
+
+			statusCode := testHelperDoRequest(t, http.DefaultClient, auth.Middleware(), http.MethodGet, "/test", http.Header{
+				echo.HeaderAuthorization: []string{"Bearer " + token},
+			})
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestRefreshTimeout(t *testing.T) {
+	provider := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer provider.Close()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: provider.issuer,
+	}, echojwtx.WithRefreshTimeout(50*time.Millisecond), echojwtx.WithReasonHeader("X-Auth-Reason"))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	provider.SetKeyIDs(TestPrivRSAKey1ID, TestPrivRSAKey2ID)
+	provider.SetJWKSDelay(500 * time.Millisecond)
+
+	signer := testHelperMustMakeSigner(jose.RS256, TestPrivRSAKey2ID, TestPrivRSAKey2)
+
+	token, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Issuer:  provider.issuer,
+		Subject: "urn:test:user",
+	}).CompactSerialize()
+
+	require.NoError(t, err, "no error expected signing token")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+
+	e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "expected request not to wait on the slow jwks refresh")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "expected 503 response")
+	assert.Equal(t, echojwtx.ReasonUnavailable, rec.Header().Get("X-Auth-Reason"), "unexpected reason header")
+}
+
+func TestStandbyJWKSURI(t *testing.T) {
+	standby := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer standby.Close()
+
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"issuer": srv.URL, "jwks_uri": srv.URL + "/jwks.json"})
+	})
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		return c.NoContent(http.StatusServiceUnavailable)
+	})
+
+	_, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	})
+
+	require.Error(t, err, "expected error without standby when primary jwks is down")
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	}, echojwtx.WithStandbyJWKSURI(standby.issuer+"/.well-known/jwks.json"))
+
+	require.NoError(t, err, "no error expected for NewAuth with standby")
+
+	router := echo.New()
+
+	router.Use(auth.Middleware())
+
+	router.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+		"iss": srv.URL,
+		"sub": "urn:test:user",
+	})))
+
+	assert.Equal(t, http.StatusOK, rec.Code, "expected standby jwks to validate token")
+}
+
+func TestStandbyJWKSURICircuitBreaker(t *testing.T) {
+	standby := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer standby.Close()
+
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"issuer": srv.URL, "jwks_uri": srv.URL + "/jwks.json"})
+	})
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		return c.NoContent(http.StatusServiceUnavailable)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the failing primary jwks opens the breaker at startup for the rest of the test.
+	auth, err := echojwtx.NewAuth(ctx, echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	},
+		echojwtx.WithStandbyJWKSURI(standby.issuer+"/.well-known/jwks.json"),
+		echojwtx.WithCircuitBreaker(1, time.Hour),
+		echojwtx.WithKeyFuncOptions(keyfunc.Options{
+			RefreshInterval:  10 * time.Millisecond,
+			RefreshRateLimit: time.Millisecond,
+		}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth with standby")
+
+	router := echo.New()
+
+	router.Use(auth.Middleware())
+
+	router.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	standby.SetKeyIDs(TestPrivRSAKey1ID, TestPrivRSAKey2ID)
+
+	rotated, err := jwt.Signed(testHelperMustMakeSigner(jose.RS256, TestPrivRSAKey2ID, TestPrivRSAKey2)).Claims(jwt.Claims{
+		Issuer:  srv.URL,
+		Subject: "urn:test:user",
+	}).CompactSerialize()
+
+	require.NoError(t, err, "no error expected signing token")
+
+	assert.Eventually(t, func() bool {
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", rotated))
+
+		return rec.Code == http.StatusOK
+	}, time.Second, 10*time.Millisecond, "expected standby jwks to refresh while the primary breaker is open")
+}
+
+func TestOnKeysChanged(t *testing.T) {
+	testCases := []struct {
+		name          string
+		initial       bool
+		expectChanges [][]string
+	}{
+		{
+			"rotation",
+			false,
+			[][]string{{TestPrivRSAKey1ID, TestPrivRSAKey2ID}},
+		},
+		{
+			"rotation with initial load",
+			true,
+			[][]string{{TestPrivRSAKey1ID}, {TestPrivRSAKey1ID, TestPrivRSAKey2ID}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := newTestOIDCProvider(TestPrivRSAKey1ID)
+			defer provider.Close()
+
+			var (
+				mu      sync.Mutex
+				changes [][]string
+			)
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: provider.issuer,
+			}, echojwtx.WithOnKeysChanged(func(keyIDs []string) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				changes = append(changes, keyIDs)
+			}), echojwtx.WithKeysChangedOnInitialLoad(tc.initial))
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			provider.SetKeyIDs(TestPrivRSAKey2ID, TestPrivRSAKey1ID)
+
+			signer := testHelperMustMakeSigner(jose.RS256, TestPrivRSAKey2ID, TestPrivRSAKey2)
+
+			token, err := jwt.Signed(signer).Claims(jwt.Claims{
+				Issuer:  provider.issuer,
+				Subject: "urn:test:user",
+			}).CompactSerialize()
+
+			require.NoError(t, err, "no error expected signing token")
+
+			statusCode := testHelperDoRequest(t, http.DefaultClient, auth.Middleware(), http.MethodGet, "/test", http.Header{
+				echo.HeaderAuthorization: []string{"Bearer " + token},
+			})
+
+			require.Equal(t, http.StatusOK, statusCode, "expected token signed by the rotated key to be accepted")
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			assert.Equal(t, tc.expectChanges, changes, "unexpected key changes")
+		})
+	}
+}
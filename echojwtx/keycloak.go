@@ -0,0 +1,77 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+)
+
+var errMissingRole = errors.New("missing required role")
+
+// WithKeycloakRoles rejects tokens missing any of the required roles with a 403. Keycloak tokens carry realm roles
+// in realm_access.roles and the roles of each client in resource_access.<client>.roles, a required role may be
+// present in either the realm roles or the roles of the provided client.
+func WithKeycloakRoles(clientID string, required ...string) Opts {
+	return func(a *Auth) {
+		a.keycloakClientID = clientID
+		a.keycloakRoles = required
+	}
+}
+
+// keycloakRoles returns the realm roles and the roles of the provided client from Keycloak token claims.
+func keycloakRoles(claims jwt.MapClaims, clientID string) []string {
+	var roles []string
+
+	if realmAccess, ok := claims["realm_access"].(map[string]interface{}); ok {
+		realmRoles, _ := claimStrings(realmAccess["roles"])
+
+		roles = append(roles, realmRoles...)
+	}
+
+	if resourceAccess, ok := claims["resource_access"].(map[string]interface{}); ok {
+		if client, ok := resourceAccess[clientID].(map[string]interface{}); ok {
+			clientRoles, _ := claimStrings(client["roles"])
+
+			roles = append(roles, clientRoles...)
+		}
+	}
+
+	return roles
+}
+
+// validateKeycloakRoles validates the token has all required Keycloak roles.
+func (a *Auth) validateKeycloakRoles(c echo.Context, claims jwt.MapClaims) error {
+	if len(a.keycloakRoles) == 0 {
+		return nil
+	}
+
+	roles := keycloakRoles(claims, a.keycloakClientID)
+
+	for _, role := range a.keycloakRoles {
+		if !slices.Contains(roles, role) {
+			a.requestLogger(c).Error("jwt user missing required role", zap.String("role", role), zap.String("client", a.keycloakClientID))
+
+			return echo.NewHTTPError(http.StatusForbidden, "missing required role").SetInternal(errMissingRole)
+		}
+	}
+
+	return nil
+}
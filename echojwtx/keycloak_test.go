@@ -0,0 +1,110 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestKeycloakRoles(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	// representative keycloak access token claims
+	claims := map[string]interface{}{
+		"iss":                issuer,
+		"sub":                "f1d2c3b4-a5e6-4f70-8192-a3b4c5d6e7f8",
+		"typ":                "Bearer",
+		"azp":                "my-service",
+		"preferred_username": "test-user",
+		"realm_access": map[string]interface{}{
+			"roles": []string{"offline_access", "uma_authorization", "realm-admin"},
+		},
+		"resource_access": map[string]interface{}{
+			"my-service": map[string]interface{}{
+				"roles": []string{"reader", "writer"},
+			},
+			"account": map[string]interface{}{
+				"roles": []string{"manage-account", "view-profile"},
+			},
+		},
+		"scope": "openid profile email",
+	}
+
+	token := testHelperMustSignClaims(claims)
+
+	testCases := []struct {
+		name             string
+		clientID         string
+		roles            []string
+		expectStatusCode int
+	}{
+		{
+			"realm role",
+			"my-service",
+			[]string{"realm-admin"},
+			http.StatusOK,
+		},
+		{
+			"client role",
+			"my-service",
+			[]string{"writer"},
+			http.StatusOK,
+		},
+		{
+			"realm and client roles",
+			"my-service",
+			[]string{"realm-admin", "reader"},
+			http.StatusOK,
+		},
+		{
+			"role of another client",
+			"my-service",
+			[]string{"manage-account"},
+			http.StatusForbidden,
+		},
+		{
+			"missing role",
+			"my-service",
+			[]string{"reader", "deleter"},
+			http.StatusForbidden,
+		},
+		{
+			"unknown client",
+			"other-service",
+			[]string{"reader"},
+			http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, echojwtx.WithKeycloakRoles(tc.clientID, tc.roles...))
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"golang.org/x/exp/slices"
+)
+
+// WithOnKeysChanged sets a function called with the key ids of every loaded JWKS, sorted, when a JWKS is fetched
+// with a different set of key ids than before, such as after a key rotation. This allows invalidating caches in
+// dependent systems. The function is called while the refreshed JWKS is being loaded, so it should return
+// quickly. By default it isn't called for the initial load, see WithKeysChangedOnInitialLoad.
+func WithOnKeysChanged(fn func(keyIDs []string)) Opts {
+	return func(a *Auth) {
+		a.onKeysChanged = fn
+	}
+}
+
+// WithKeysChangedOnInitialLoad sets whether the function set by WithOnKeysChanged is also called when each JWKS is
+// first loaded.
+func WithKeysChangedOnInitialLoad(enabled bool) Opts {
+	return func(a *Auth) {
+		a.keysChangedInitial = enabled
+	}
+}
+
+// keyChangeTracker tracks the key ids of each JWKS uri to report changes.
+type keyChangeTracker struct {
+	fn      func(keyIDs []string)
+	initial bool
+
+	mu   sync.Mutex
+	keys map[string][]string
+}
+
+// observe records the key ids fetched from the uri, calling the tracker function if they changed.
+func (t *keyChangeTracker) observe(uri string, keyIDs []string) {
+	sort.Strings(keyIDs)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, loaded := t.keys[uri]
+	if loaded && slices.Equal(previous, keyIDs) {
+		return
+	}
+
+	t.keys[uri] = keyIDs
+
+	if !loaded && !t.initial {
+		return
+	}
+
+	var all []string
+
+	for _, ids := range t.keys {
+		for _, id := range ids {
+			if !slices.Contains(all, id) {
+				all = append(all, id)
+			}
+		}
+	}
+
+	sort.Strings(all)
+
+	t.fn(all)
+}
+
+// keyChangeExtractor wraps the JWKS response extractor to report key id changes of fetched JWKS.
+func (a *Auth) keyChangeExtractor(extractor func(ctx context.Context, resp *http.Response) (json.RawMessage, error)) func(ctx context.Context, resp *http.Response) (json.RawMessage, error) {
+	tracker := &keyChangeTracker{
+		fn:      a.onKeysChanged,
+		initial: a.keysChangedInitial,
+		keys:    make(map[string][]string),
+	}
+
+	return func(ctx context.Context, resp *http.Response) (json.RawMessage, error) {
+		raw, err := extractor(ctx, resp)
+		if err != nil || resp.Request == nil {
+			return raw, err
+		}
+
+		var jwks struct {
+			Keys []struct {
+				KeyID string `json:"kid"`
+			} `json:"keys"`
+		}
+
+		if json.Unmarshal(raw, &jwks) == nil {
+			keyIDs := make([]string, 0, len(jwks.Keys))
+
+			for _, key := range jwks.Keys {
+				keyIDs = append(keyIDs, key.KeyID)
+			}
+
+			tracker.observe(resp.Request.URL.String(), keyIDs)
+		}
+
+		return raw, nil
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/exp/slices"
+)
+
+var errKIDNotAllowed = errors.New("token kid is not allowed")
+
+// WithAllowedKIDs pins the key ids accepted for signing tokens. Tokens whose kid header isn't one of the provided
+// kids, including tokens without a kid, are rejected before a key is resolved. This protects against a compromised
+// JWKS endpoint serving a rogue key, but requires updating the allowlist before the issuer rotates keys.
+func WithAllowedKIDs(kids ...string) Opts {
+	return func(a *Auth) {
+		a.allowedKIDs = kids
+	}
+}
+
+// allowedKIDKeyfunc wraps the provided keyfunc, rejecting tokens whose kid is not allowed.
+func (a *Auth) allowedKIDKeyfunc(next jwt.Keyfunc) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		if kid == "" || !slices.Contains(a.allowedKIDs, kid) {
+			return nil, errKIDNotAllowed
+		}
+
+		return next(token)
+	}
+}
@@ -0,0 +1,87 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestAllowedKIDs(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID, TestPrivRSAKey2ID)
+	defer closer()
+
+	testCases := []struct {
+		name             string
+		kid              string
+		key              interface{}
+		expectStatusCode int
+		expectReason     string
+	}{
+		{
+			"allowed kid",
+			TestPrivRSAKey1ID,
+			TestPrivRSAKey1,
+			http.StatusOK,
+			"",
+		},
+		{
+			"disallowed kid",
+			TestPrivRSAKey2ID,
+			TestPrivRSAKey2,
+			http.StatusUnauthorized,
+			echojwtx.ReasonUnknownKey,
+		},
+		{
+			"missing kid",
+			"",
+			TestPrivRSAKey1,
+			http.StatusUnauthorized,
+			echojwtx.ReasonUnknownKey,
+		},
+	}
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: issuer,
+		},
+		echojwtx.WithAllowedKIDs(TestPrivRSAKey1ID),
+		echojwtx.WithReasonHeader("X-Auth-Reason"),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := jwt.Signed(testHelperMustMakeSigner(jose.RS256, tc.kid, tc.key)).Claims(jwt.Claims{
+				Issuer:  issuer,
+				Subject: "urn:test:user",
+			}).CompactSerialize()
+
+			require.NoError(t, err, "no error expected signing token")
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+			assert.Equal(t, tc.expectReason, rec.Header().Get("X-Auth-Reason"), "unexpected reason header")
+		})
+	}
+}
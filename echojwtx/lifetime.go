@@ -0,0 +1,241 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	errIssuedInFuture       = errors.New("token used before issued")
+	errTokenLifetimeTooLong = errors.New("token lifetime exceeds maximum")
+	errIssuedBeforeMinimum  = errors.New("token issued before minimum issued at")
+	errIssuedTooLongAgo     = errors.New("token issued too long ago")
+	errIssuedAtRequired     = errors.New("token issued at required")
+)
+
+// WithClock sets the function used to get the current time for all time based validations, such as the exp, nbf
+// and iat claims. This defaults to time.Now. The clock is not used by a ParseTokenFunc provided in the JWTConfig.
+func WithClock(now func() time.Time) Opts {
+	return func(a *Auth) {
+		a.clock = now
+	}
+}
+
+// now returns the current time from the configured clock.
+func (a *Auth) now() time.Time {
+	if a.clock != nil {
+		return a.clock()
+	}
+
+	return time.Now()
+}
+
+// maxClockSkew is the largest clock skew accepted without WithAllowLargeClockSkew.
+const maxClockSkew = 5 * time.Minute
+
+// WithClockSkew sets the leeway allowed when validating the exp and nbf claims to account for clock skew between
+// the issuer and the server. The clock skew is not used by a ParseTokenFunc provided in the JWTConfig.
+// NewAuth returns ErrClockSkewTooLarge for a clock skew above five minutes, see WithAllowLargeClockSkew.
+func WithClockSkew(d time.Duration) Opts {
+	return func(a *Auth) {
+		a.clockSkew = d
+	}
+}
+
+// WithAllowLargeClockSkew allows a clock skew or expiry grace period above five minutes. A large clock skew
+// accepts tokens long after they've expired, this should only be set when the issuer's clock is known to drift
+// that far.
+func WithAllowLargeClockSkew() Opts {
+	return func(a *Auth) {
+		a.allowLargeSkew = true
+	}
+}
+
+// WithExpiryGraceByMethod sets a grace period after the exp claim during which tokens are still accepted for
+// specific request methods, such as allowing reads with a token which expired while the client is refreshing it
+// while writes enforce strict expiry. The grace only applies to the exp check and is added to the clock skew.
+// Methods not in the map have no grace period. NewAuth returns ErrClockSkewTooLarge for a grace period above five
+// minutes, see WithAllowLargeClockSkew.
+func WithExpiryGraceByMethod(grace map[string]time.Duration) Opts {
+	return func(a *Auth) {
+		a.expiryGrace = make(map[string]time.Duration, len(grace))
+
+		for method, d := range grace {
+			a.expiryGrace[strings.ToUpper(method)] = d
+		}
+	}
+}
+
+// expiryGraceFor returns the grace period after expiry for the request method.
+func (a *Auth) expiryGraceFor(c echo.Context) time.Duration {
+	return a.expiryGrace[c.Request().Method]
+}
+
+// WithIssuedAtLeeway enables rejecting tokens with an iat claim further in the future than the provided leeway.
+// The leeway only applies to the iat check, leaving exp and nbf enforcement unchanged.
+// Without this option the iat claim is not validated.
+func WithIssuedAtLeeway(d time.Duration) Opts {
+	return func(a *Auth) {
+		a.verifyIssuedAt = true
+		a.issuedAtLeeway = d
+	}
+}
+
+// WithMaxTokenLifetime rejects tokens whose lifetime, the difference between the exp and iat claims, exceeds
+// the provided maximum regardless of the issuer's settings. Tokens missing either claim are rejected.
+func WithMaxTokenLifetime(d time.Duration) Opts {
+	return func(a *Auth) {
+		a.maxTokenLifetime = d
+	}
+}
+
+// WithMinIssuedAt rejects tokens with an iat claim before the provided cutoff, revoking every token issued
+// before it without involving the issuer. Tokens missing the iat claim are rejected. The cutoff can be changed
+// at runtime with SetMinIssuedAt.
+func WithMinIssuedAt(t time.Time) Opts {
+	return func(a *Auth) {
+		a.SetMinIssuedAt(t)
+	}
+}
+
+// SetMinIssuedAt sets the cutoff before which tokens are rejected, see WithMinIssuedAt. It is safe to call while
+// requests are being served. A zero time removes the cutoff.
+func (a *Auth) SetMinIssuedAt(t time.Time) {
+	if t.IsZero() {
+		a.minIssuedAt.Store(nil)
+
+		return
+	}
+
+	a.minIssuedAt.Store(&t)
+}
+
+// validateMinIssuedAt rejects tokens issued before the configured cutoff.
+func (a *Auth) validateMinIssuedAt(c echo.Context, claims jwt.MapClaims) error {
+	minIssuedAt := a.minIssuedAt.Load()
+	if minIssuedAt == nil {
+		return nil
+	}
+
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		a.requestLogger(c).Error("jwt user claim missing issued at", zap.Error(err), zap.Any("iat", claims["iat"]))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errIssuedBeforeMinimum)
+	}
+
+	if issuedAt.Before(*minIssuedAt) {
+		a.requestLogger(c).Error("jwt user claim issued before minimum", zap.Time("iat", issuedAt.Time), zap.Time("min_iat", *minIssuedAt))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errIssuedBeforeMinimum)
+	}
+
+	return nil
+}
+
+// WithIssuedAtWindow rejects tokens with an iat claim more than maxAge in the past or more than maxFuture in the
+// future, mitigating the replay of old tokens regardless of their expiry. Tokens missing the iat claim are
+// rejected. This is applied in addition to WithIssuedAtLeeway.
+func WithIssuedAtWindow(maxAge, maxFuture time.Duration) Opts {
+	return func(a *Auth) {
+		a.issuedAtWindow = true
+		a.issuedAtMaxAge = maxAge
+		a.issuedAtMaxAhead = maxFuture
+	}
+}
+
+// validateIssuedAtWindow rejects tokens issued outside the configured window around the current time.
+func (a *Auth) validateIssuedAtWindow(c echo.Context, claims jwt.MapClaims) error {
+	if !a.issuedAtWindow {
+		return nil
+	}
+
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		a.requestLogger(c).Error("jwt user claim missing issued at", zap.Error(err), zap.Any("iat", claims["iat"]))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errIssuedAtRequired)
+	}
+
+	now := a.now()
+
+	if issuedAt.Before(now.Add(-a.issuedAtMaxAge)) {
+		a.requestLogger(c).Error("jwt user claim issued too long ago", zap.Time("iat", issuedAt.Time))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errIssuedTooLongAgo)
+	}
+
+	if issuedAt.After(now.Add(a.issuedAtMaxAhead)) {
+		a.requestLogger(c).Error("jwt user claim issued in the future", zap.Time("iat", issuedAt.Time))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errIssuedInFuture)
+	}
+
+	return nil
+}
+
+// validateIssuedAt rejects tokens issued further in the future than the configured leeway.
+func (a *Auth) validateIssuedAt(c echo.Context, claims jwt.MapClaims) error {
+	if !a.verifyIssuedAt {
+		return nil
+	}
+
+	issuedAt, err := claims.GetIssuedAt()
+	if err != nil {
+		a.requestLogger(c).Error("jwt user failed to get issued at", zap.Error(err), zap.Any("iat", claims["iat"]))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(err)
+	}
+
+	if issuedAt != nil && issuedAt.After(a.now().Add(a.issuedAtLeeway)) {
+		a.requestLogger(c).Error("jwt user claim issued in the future", zap.Time("iat", issuedAt.Time))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errIssuedInFuture)
+	}
+
+	return nil
+}
+
+// validateTokenLifetime rejects tokens with a lifetime longer than the configured maximum.
+func (a *Auth) validateTokenLifetime(c echo.Context, claims jwt.MapClaims) error {
+	if a.maxTokenLifetime == 0 {
+		return nil
+	}
+
+	issuedAt, iatErr := claims.GetIssuedAt()
+	expiresAt, expErr := claims.GetExpirationTime()
+
+	if iatErr != nil || expErr != nil || issuedAt == nil || expiresAt == nil {
+		a.requestLogger(c).Error("jwt user claims missing iat or exp", zap.Any("iat", claims["iat"]), zap.Any("exp", claims["exp"]))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errTokenLifetimeTooLong)
+	}
+
+	if lifetime := expiresAt.Sub(issuedAt.Time); lifetime > a.maxTokenLifetime {
+		a.requestLogger(c).Error("jwt user token lifetime exceeds maximum", zap.Duration("lifetime", lifetime))
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errTokenLifetimeTooLong)
+	}
+
+	return nil
+}
@@ -0,0 +1,500 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestIssuedAtLeeway(t *testing.T) {
+	testCases := []struct {
+		name             string
+		issuedAt         time.Duration
+		opts             []echojwtx.Opts
+		expectStatusCode int
+	}{
+		{
+			"future iat without leeway option",
+			5 * time.Second,
+			nil,
+			http.StatusOK,
+		},
+		{
+			"future iat within leeway",
+			5 * time.Second,
+			[]echojwtx.Opts{echojwtx.WithIssuedAtLeeway(30 * time.Second)},
+			http.StatusOK,
+		},
+		{
+			"future iat beyond leeway",
+			5 * time.Second,
+			[]echojwtx.Opts{echojwtx.WithIssuedAtLeeway(time.Second)},
+			http.StatusUnauthorized,
+		},
+		{
+			"past iat",
+			-5 * time.Second,
+			[]echojwtx.Opts{echojwtx.WithIssuedAtLeeway(0)},
+			http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				return map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+					"iat": time.Now().Add(tc.issuedAt).Unix(),
+				}
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, tc.opts...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestMaxTokenLifetime(t *testing.T) {
+	testCases := []struct {
+		name             string
+		issuedAt         bool
+		lifetime         time.Duration
+		expectStatusCode int
+	}{
+		{
+			"short lived token",
+			true,
+			30 * time.Minute,
+			http.StatusOK,
+		},
+		{
+			"long lived token",
+			true,
+			24 * time.Hour,
+			http.StatusUnauthorized,
+		},
+		{
+			"missing iat",
+			false,
+			30 * time.Minute,
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				now := time.Now()
+
+				claims := map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+					"exp": now.Add(tc.lifetime).Unix(),
+				}
+
+				if tc.issuedAt {
+					claims["iat"] = now.Unix()
+				}
+
+				return claims
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithMaxTokenLifetime(time.Hour),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestMinIssuedAt(t *testing.T) {
+	cutoff := time.Now().Add(-time.Hour)
+
+	testCases := []struct {
+		name             string
+		issuedAt         *time.Time
+		expectStatusCode int
+	}{
+		{
+			"issued after cutoff",
+			timePtr(cutoff.Add(time.Minute)),
+			http.StatusOK,
+		},
+		{
+			"issued before cutoff",
+			timePtr(cutoff.Add(-time.Minute)),
+			http.StatusUnauthorized,
+		},
+		{
+			"missing iat",
+			nil,
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				claims := map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+				}
+
+				if tc.issuedAt != nil {
+					claims["iat"] = tc.issuedAt.Unix()
+				}
+
+				return claims
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithMinIssuedAt(cutoff),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+
+	t.Run("set at runtime", func(t *testing.T) {
+		oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+			return map[string]interface{}{
+				"iss": issuer,
+				"sub": "urn:test:user",
+				"iat": cutoff.Unix(),
+			}
+		})
+		defer closer()
+
+		auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+			Issuer: issuer,
+		})
+
+		require.NoError(t, err, "no error expected for NewAuth")
+
+		statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+		assert.Equal(t, http.StatusOK, statusCode, "expected token to be accepted without a cutoff")
+
+		auth.SetMinIssuedAt(cutoff.Add(time.Minute))
+
+		statusCode = testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+		assert.Equal(t, http.StatusUnauthorized, statusCode, "expected token issued before the cutoff to be rejected")
+
+		auth.SetMinIssuedAt(time.Time{})
+
+		statusCode = testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+		assert.Equal(t, http.StatusOK, statusCode, "expected token to be accepted after the cutoff is removed")
+	})
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestIssuedAtWindow(t *testing.T) {
+	testCases := []struct {
+		name             string
+		issuedAt         *time.Duration
+		expectStatusCode int
+	}{
+		{
+			"in window",
+			durationPtr(-time.Minute),
+			http.StatusOK,
+		},
+		{
+			"slightly in the future",
+			durationPtr(5 * time.Second),
+			http.StatusOK,
+		},
+		{
+			"too old",
+			durationPtr(-10 * time.Minute),
+			http.StatusUnauthorized,
+		},
+		{
+			"too far in the future",
+			durationPtr(time.Minute),
+			http.StatusUnauthorized,
+		},
+		{
+			"missing iat",
+			nil,
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				claims := map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+				}
+
+				if tc.issuedAt != nil {
+					claims["iat"] = time.Now().Add(*tc.issuedAt).Unix()
+				}
+
+				return claims
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithIssuedAtWindow(5*time.Minute, 30*time.Second),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestExpiryGraceByMethod(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	now := time.Now()
+
+	testCases := []struct {
+		name             string
+		method           string
+		claims           map[string]interface{}
+		opts             []echojwtx.Opts
+		expectStatusCode int
+	}{
+		{
+			"expired read within grace",
+			http.MethodGet,
+			map[string]interface{}{"exp": now.Add(-5 * time.Second).Unix()},
+			[]echojwtx.Opts{echojwtx.WithExpiryGraceByMethod(map[string]time.Duration{"get": 30 * time.Second})},
+			http.StatusOK,
+		},
+		{
+			"expired write without grace",
+			http.MethodPost,
+			map[string]interface{}{"exp": now.Add(-5 * time.Second).Unix()},
+			[]echojwtx.Opts{echojwtx.WithExpiryGraceByMethod(map[string]time.Duration{"get": 30 * time.Second})},
+			http.StatusUnauthorized,
+		},
+		{
+			"expired read beyond grace",
+			http.MethodGet,
+			map[string]interface{}{"exp": now.Add(-time.Minute).Unix()},
+			[]echojwtx.Opts{echojwtx.WithExpiryGraceByMethod(map[string]time.Duration{"get": 30 * time.Second})},
+			http.StatusUnauthorized,
+		},
+		{
+			"expired read without option",
+			http.MethodGet,
+			map[string]interface{}{"exp": now.Add(-5 * time.Second).Unix()},
+			nil,
+			http.StatusUnauthorized,
+		},
+		{
+			"grace does not extend nbf",
+			http.MethodGet,
+			map[string]interface{}{"exp": now.Add(time.Hour).Unix(), "nbf": now.Add(10 * time.Second).Unix()},
+			[]echojwtx.Opts{echojwtx.WithExpiryGraceByMethod(map[string]time.Duration{"get": 30 * time.Second})},
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				tc.opts...,
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.Any("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			tc.claims["iss"] = issuer
+			tc.claims["sub"] = "urn:test:user"
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(tc.method, "/test", testHelperMustSignClaims(tc.claims)))
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestClock(t *testing.T) {
+	frozen := time.Now().Add(-24 * time.Hour)
+
+	testCases := []struct {
+		name             string
+		opts             []echojwtx.Opts
+		expectStatusCode int
+	}{
+		{
+			"real clock",
+			nil,
+			http.StatusUnauthorized,
+		},
+		{
+			"frozen clock",
+			[]echojwtx.Opts{echojwtx.WithClock(func() time.Time { return frozen })},
+			http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				return map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+					"iat": frozen.Add(-time.Minute).Unix(),
+					"nbf": frozen.Add(-time.Minute).Unix(),
+					"exp": frozen.Add(time.Hour).Unix(),
+				}
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, tc.opts...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	testCases := []struct {
+		name             string
+		opts             []echojwtx.Opts
+		expectStatusCode int
+	}{
+		{
+			"no clock skew",
+			nil,
+			http.StatusUnauthorized,
+		},
+		{
+			"within clock skew",
+			[]echojwtx.Opts{echojwtx.WithClockSkew(time.Minute)},
+			http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				return map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+					"exp": time.Now().Add(-10 * time.Second).Unix(),
+				}
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, tc.opts...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestMaxClockSkew(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	_, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithClockSkew(24*time.Hour))
+
+	require.ErrorIs(t, err, echojwtx.ErrClockSkewTooLarge, "expected oversized clock skew to be rejected")
+
+	_, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithClockSkew(5*time.Minute))
+
+	require.NoError(t, err, "no error expected for clock skew at the maximum")
+
+	_, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithClockSkew(24*time.Hour), echojwtx.WithAllowLargeClockSkew())
+
+	require.NoError(t, err, "no error expected when large clock skew is allowed")
+
+	grace := echojwtx.WithExpiryGraceByMethod(map[string]time.Duration{"get": time.Minute, "head": time.Hour})
+
+	_, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, grace)
+
+	require.ErrorIs(t, err, echojwtx.ErrClockSkewTooLarge, "expected oversized expiry grace to be rejected")
+
+	_, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, grace, echojwtx.WithAllowLargeClockSkew())
+
+	require.NoError(t, err, "no error expected when large expiry grace is allowed")
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// WithLoggerEnrichment stores a logger with the token subject and issuer fields under the provided echo context
+// key for authenticated requests, so logs written by later middleware and handlers are attributed to the
+// principal. If a *zap.Logger was already stored under the key, such as by a request logging middleware, the
+// fields are added to it, otherwise to the auth logger. No other claims are added.
+func WithLoggerEnrichment(contextKey string) Opts {
+	return func(a *Auth) {
+		a.loggerContextKey = contextKey
+	}
+}
+
+// enrichLogger stores the logger with the subject and issuer fields under the configured context key.
+func (a *Auth) enrichLogger(c echo.Context, claims jwt.MapClaims) {
+	if a.loggerContextKey == "" {
+		return
+	}
+
+	logger, ok := c.Get(a.loggerContextKey).(*zap.Logger)
+	if !ok || logger == nil {
+		logger = a.logger
+	}
+
+	subject, _ := claims[a.subjectClaimName()].(string)
+	issuer, _ := claims.GetIssuer()
+
+	c.Set(a.loggerContextKey, logger.With(zap.String("subject", subject), zap.String("issuer", issuer)))
+}
@@ -0,0 +1,272 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// metricsLabelUnknown is the label value used when a request has no verified token or the claim is missing.
+	metricsLabelUnknown = "unknown"
+
+	// metricsLabelOther is the label value used once a label has reached metricsMaxLabelValues distinct values.
+	metricsLabelOther = "other"
+
+	// metricsMaxLabelValues bounds the number of distinct values recorded for each label.
+	metricsMaxLabelValues = 100
+)
+
+// ErrHighCardinalityMetricsLabel is returned when a metrics claim label is configured for a claim which is unique
+// per principal or per token.
+var ErrHighCardinalityMetricsLabel = errors.New("metrics claim label has unbounded cardinality")
+
+// highCardinalityClaims are claims rejected as metrics labels as their values are unique per principal or token.
+var highCardinalityClaims = []string{
+	"sub", "jti", "iat", "exp", "nbf", "auth_time", "sid", "nonce", "at_hash", "c_hash", "email", "cnf",
+}
+
+// WithMetricsRegisterer registers the auth middleware's prometheus metrics with the provided registerer:
+//
+//   - echojwtx_auth_requests_total counts requests by outcome, reason and issuer, and the claim configured with
+//     WithMetricsClaimLabel.
+//   - echojwtx_jwks_key_cache_hits_total counts token keys resolved from the cached JWKS.
+//   - echojwtx_jwks_forced_refreshes_total counts JWKS refreshes triggered by tokens with an unknown key id.
+//
+// Metrics already registered, such as by another Auth using the same registerer, are shared.
+//
+// The issuer label is only read from verified tokens, a forged token can't create new series. Every label is
+// still bounded to 100 distinct values, further values are recorded as "other".
+func WithMetricsRegisterer(reg prometheus.Registerer) Opts {
+	return func(a *Auth) {
+		a.metricsRegisterer = reg
+	}
+}
+
+// WithMetricsClaimLabel adds a label named after the provided claim to echojwtx_auth_requests_total, such as a
+// tenant or aud claim, so auth outcomes may be broken down by tenant. Array claims are joined with commas.
+//
+// Every distinct claim value creates a new time series, only claims with a small, fixed set of values should be
+// used. NewAuth returns ErrHighCardinalityMetricsLabel for claims unique per principal or token, such as sub or
+// jti, though any claim beyond 100 distinct values is recorded as "other".
+func WithMetricsClaimLabel(claim string) Opts {
+	return func(a *Auth) {
+		a.metricsClaimLabel = claim
+	}
+}
+
+// jwksMetrics counts how keys are resolved from the JWKS. A nil jwksMetrics records nothing.
+type jwksMetrics struct {
+	cacheHits       prometheus.Counter
+	forcedRefreshes prometheus.Counter
+}
+
+// newJWKSMetrics creates and registers the JWKS metrics with the provided registerer.
+func newJWKSMetrics(reg prometheus.Registerer) (*jwksMetrics, error) {
+	cacheHits, err := registerCounter(reg, prometheus.CounterOpts{
+		Name: "echojwtx_jwks_key_cache_hits_total",
+		Help: "Number of token keys resolved from the cached JWKS.",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	forcedRefreshes, err := registerCounter(reg, prometheus.CounterOpts{
+		Name: "echojwtx_jwks_forced_refreshes_total",
+		Help: "Number of JWKS refreshes triggered by tokens with an unknown key id.",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &jwksMetrics{
+		cacheHits:       cacheHits,
+		forcedRefreshes: forcedRefreshes,
+	}, nil
+}
+
+// registerCounter registers a counter, returning the existing counter if one is already registered.
+func registerCounter(reg prometheus.Registerer, opts prometheus.CounterOpts) (prometheus.Counter, error) {
+	counter := prometheus.NewCounter(opts)
+
+	if err := reg.Register(counter); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+
+		if errors.As(err, &registered) {
+			if existing, ok := registered.ExistingCollector.(prometheus.Counter); ok {
+				return existing, nil
+			}
+		}
+
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// cacheHit records a key resolved from the cached JWKS.
+func (m *jwksMetrics) cacheHit() {
+	if m != nil {
+		m.cacheHits.Inc()
+	}
+}
+
+// forcedRefresh records a JWKS refresh triggered by an unknown key id.
+func (m *jwksMetrics) forcedRefresh() {
+	if m != nil {
+		m.forcedRefreshes.Inc()
+	}
+}
+
+// authMetrics counts requests authenticated or rejected by the middleware. A nil authMetrics records nothing.
+type authMetrics struct {
+	requests *prometheus.CounterVec
+	claim    string
+
+	mu     sync.Mutex
+	values map[string]map[string]struct{}
+}
+
+// newAuthMetrics creates and registers the request metrics with the provided registerer.
+func newAuthMetrics(reg prometheus.Registerer, claim string) (*authMetrics, error) {
+	labels := []string{"outcome", "reason", "issuer"}
+
+	if claim != "" {
+		if slices.Contains(highCardinalityClaims, claim) || slices.Contains(labels, claim) {
+			return nil, ErrHighCardinalityMetricsLabel
+		}
+
+		labels = append(labels, claim)
+	}
+
+	requests, err := registerCounterVec(reg, prometheus.CounterOpts{
+		Name: "echojwtx_auth_requests_total",
+		Help: "Number of requests authenticated or rejected by the auth middleware.",
+	}, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authMetrics{
+		requests: requests,
+		claim:    claim,
+		values:   make(map[string]map[string]struct{}),
+	}, nil
+}
+
+// registerCounterVec registers a counter vec, returning the existing counter vec if one is already registered.
+func registerCounterVec(reg prometheus.Registerer, opts prometheus.CounterOpts, labels []string) (*prometheus.CounterVec, error) {
+	counter := prometheus.NewCounterVec(opts, labels)
+
+	if err := reg.Register(counter); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+
+		if errors.As(err, &registered) {
+			if existing, ok := registered.ExistingCollector.(*prometheus.CounterVec); ok {
+				return existing, nil
+			}
+		}
+
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// record counts a request with the provided outcome, labeled from the verified token claims if any.
+func (m *authMetrics) record(claims jwt.MapClaims, outcome string, err error) {
+	if m == nil {
+		return
+	}
+
+	reason := ""
+
+	if err != nil {
+		reason = ErrorReason(err)
+	}
+
+	labels := prometheus.Labels{
+		"outcome": outcome,
+		"reason":  reason,
+		"issuer":  m.labelValue("issuer", claims, "iss"),
+	}
+
+	if m.claim != "" {
+		labels[m.claim] = m.labelValue(m.claim, claims, m.claim)
+	}
+
+	counter, err := m.requests.GetMetricWith(labels)
+	if err != nil {
+		// the labels differ from an existing registration of the metric.
+		return
+	}
+
+	counter.Inc()
+}
+
+// labelValue returns the value of the claim for the label, bounded to metricsMaxLabelValues distinct values.
+func (m *authMetrics) labelValue(label string, claims jwt.MapClaims, claim string) string {
+	raw, ok := claims[claim]
+	if !ok || raw == nil {
+		return metricsLabelUnknown
+	}
+
+	value := claimString(raw)
+	if value == "" {
+		return metricsLabelUnknown
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen, ok := m.values[label]
+	if !ok {
+		seen = make(map[string]struct{})
+		m.values[label] = seen
+	}
+
+	if _, ok := seen[value]; ok {
+		return value
+	}
+
+	if len(seen) >= metricsMaxLabelValues {
+		return metricsLabelOther
+	}
+
+	seen[value] = struct{}{}
+
+	return value
+}
+
+// recordMetrics counts the request with the provided outcome.
+func (a *Auth) recordMetrics(c echo.Context, outcome string, err error) {
+	if a.authMetrics == nil {
+		return
+	}
+
+	var claims jwt.MapClaims
+
+	if token, ok := c.Get(a.contextKey()).(*jwt.Token); ok && token != nil {
+		claims, _ = token.Claims.(jwt.MapClaims)
+	}
+
+	a.authMetrics.record(claims, outcome, err)
+}
@@ -0,0 +1,166 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestMetricsRegisterer(t *testing.T) {
+	provider := newTestOIDCProvider(TestPrivRSAKey1ID)
+	defer provider.Close()
+
+	reg := prometheus.NewRegistry()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: provider.issuer,
+	}, echojwtx.WithMetricsRegisterer(reg))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	_, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: provider.issuer,
+	}, echojwtx.WithMetricsRegisterer(reg))
+
+	require.NoError(t, err, "expected metrics to be shared with an existing registration")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	doRequest := func(token string) int {
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+		return rec.Code
+	}
+
+	cached := testHelperMustSignClaims(map[string]interface{}{"iss": provider.issuer, "sub": "urn:test:user"})
+
+	assert.Equal(t, http.StatusOK, doRequest(cached), "expected 200 response from test server")
+	assert.Equal(t, http.StatusOK, doRequest(cached), "expected 200 response from test server")
+
+	provider.SetKeyIDs(TestPrivRSAKey1ID, TestPrivRSAKey2ID)
+
+	unknown, err := jwt.Signed(testHelperMustMakeSigner(jose.RS256, TestPrivRSAKey2ID, TestPrivRSAKey2)).Claims(jwt.Claims{
+		Issuer:  provider.issuer,
+		Subject: "urn:test:user",
+	}).CompactSerialize()
+
+	require.NoError(t, err, "no error expected signing token")
+
+	assert.Equal(t, http.StatusOK, doRequest(unknown), "expected 200 response after refresh")
+
+	families, err := reg.Gather()
+	require.NoError(t, err, "no error expected gathering metrics")
+
+	values := make(map[string]float64)
+
+	for _, family := range families {
+		values[family.GetName()] = family.GetMetric()[0].GetCounter().GetValue()
+	}
+
+	assert.Equal(t, float64(2), values["echojwtx_jwks_key_cache_hits_total"], "unexpected cache hits")
+	assert.Equal(t, float64(1), values["echojwtx_jwks_forced_refreshes_total"], "unexpected forced refreshes")
+}
+
+func TestMetricsClaimLabel(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	_, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithMetricsRegisterer(prometheus.NewRegistry()), echojwtx.WithMetricsClaimLabel("sub"))
+
+	require.ErrorIs(t, err, echojwtx.ErrHighCardinalityMetricsLabel, "expected sub to be rejected as a metrics label")
+
+	reg := prometheus.NewRegistry()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer:   issuer,
+		Audience: "test-aud",
+	}, echojwtx.WithMetricsRegisterer(reg), echojwtx.WithMetricsClaimLabel("tenant"))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	doRequest := func(token string) int {
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+		return rec.Code
+	}
+
+	valid := testHelperMustSignClaims(map[string]interface{}{
+		"iss":    issuer,
+		"aud":    "test-aud",
+		"sub":    "urn:test:user",
+		"tenant": "tenant-a",
+	})
+
+	wrongAudience := testHelperMustSignClaims(map[string]interface{}{
+		"iss":    issuer,
+		"aud":    "other-aud",
+		"sub":    "urn:test:user",
+		"tenant": "tenant-b",
+	})
+
+	assert.Equal(t, http.StatusOK, doRequest(valid), "expected 200 response from test server")
+	assert.Equal(t, http.StatusOK, doRequest(valid), "expected 200 response from test server")
+	assert.Equal(t, http.StatusUnauthorized, doRequest(wrongAudience), "expected 401 response for wrong audience")
+	assert.Equal(t, http.StatusUnauthorized, doRequest("not-a-jwt"), "expected 401 response for malformed token")
+
+	families, err := reg.Gather()
+	require.NoError(t, err, "no error expected gathering metrics")
+
+	values := make(map[string]float64)
+
+	for _, family := range families {
+		if family.GetName() != "echojwtx_auth_requests_total" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			key := labels["outcome"] + "|" + labels["reason"] + "|" + labels["issuer"] + "|" + labels["tenant"]
+
+			values[key] = metric.GetCounter().GetValue()
+		}
+	}
+
+	expected := map[string]float64{
+		"success||" + issuer + "|tenant-a":                                       2,
+		"failure|" + echojwtx.ReasonInvalidAudience + "|" + issuer + "|tenant-b": 1,
+		"failure|" + echojwtx.ReasonMalformedToken + "|unknown|unknown":          1,
+	}
+
+	assert.Equal(t, expected, values, "unexpected auth request metrics")
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+var errInvalidNonce = errors.New("invalid nonce")
+
+// WithNonceValidator rejects tokens whose nonce claim doesn't match the nonce expected for the request, such as
+// an ID token in an OIDC login callback which must carry the nonce sent with the authentication request.
+// fn returns the expected nonce, for example from a cookie or session. Tokens without a nonce are rejected when
+// a nonce is expected, while no nonce is required when fn returns an empty string.
+func WithNonceValidator(fn func(c echo.Context) string) Opts {
+	return func(a *Auth) {
+		a.nonceValidator = fn
+	}
+}
+
+// validateNonce validates the token nonce matches the expected nonce for the request.
+func (a *Auth) validateNonce(c echo.Context, claims jwt.MapClaims) error {
+	if a.nonceValidator == nil {
+		return nil
+	}
+
+	expected := a.nonceValidator(c)
+	if expected == "" {
+		return nil
+	}
+
+	nonce, _ := claims["nonce"].(string)
+
+	if subtle.ConstantTimeCompare([]byte(nonce), []byte(expected)) != 1 {
+		a.requestLogger(c).Error("jwt user claim invalid nonce")
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errInvalidNonce)
+	}
+
+	return nil
+}
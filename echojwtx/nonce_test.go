@@ -0,0 +1,77 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestNonceValidator(t *testing.T) {
+	testCases := []struct {
+		name             string
+		nonce            interface{}
+		expected         string
+		expectStatusCode int
+	}{
+		{
+			"matching nonce",
+			"abc123",
+			"abc123",
+			http.StatusOK,
+		},
+		{
+			"mismatched nonce",
+			"other",
+			"abc123",
+			http.StatusUnauthorized,
+		},
+		{
+			"missing nonce",
+			nil,
+			"abc123",
+			http.StatusUnauthorized,
+		},
+		{
+			"no nonce expected",
+			nil,
+			"",
+			http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				claims := map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+				}
+
+				if tc.nonce != nil {
+					claims["nonce"] = tc.nonce
+				}
+
+				return claims
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, echojwtx.WithNonceValidator(func(_ echo.Context) string {
+				return tc.expected
+			}))
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
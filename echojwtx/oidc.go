@@ -0,0 +1,101 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+
+	// register hash implementations used for at_hash validation.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var (
+	errInvalidAtHash     = errors.New("invalid at_hash")
+	errAtHashUnsupported = errors.New("unsupported at_hash signing algorithm")
+)
+
+// WithAccessTokenForAtHash validates the at_hash claim of ID tokens against the access token returned by fn.
+// Tokens missing at_hash, requests without an access token or mismatched hashes are rejected with a 401.
+//
+// As defined by OpenID Connect Core 1.0, the hash algorithm is selected from the token's alg header: the SHA-2
+// hash matching the alg's bit length is used (SHA-256 for RS256, ES256 and PS256, etc.) and SHA-512 for EdDSA.
+// The at_hash is the base64url encoding of the left-most half of the hash of the access token.
+func WithAccessTokenForAtHash(fn func(c echo.Context) string) Opts {
+	return func(a *Auth) {
+		a.atHashAccessToken = fn
+	}
+}
+
+// atHashAlgorithm returns the hash used to compute at_hash for the provided signing algorithm.
+func atHashAlgorithm(alg string) (crypto.Hash, error) {
+	switch alg {
+	case "RS256", "ES256", "PS256", "HS256":
+		return crypto.SHA256, nil
+	case "RS384", "ES384", "PS384", "HS384":
+		return crypto.SHA384, nil
+	case "RS512", "ES512", "PS512", "HS512", "EdDSA":
+		return crypto.SHA512, nil
+	default:
+		return 0, errAtHashUnsupported
+	}
+}
+
+// atHash computes the at_hash value for the access token using the provided signing algorithm.
+func atHash(alg, accessToken string) (string, error) {
+	hash, err := atHashAlgorithm(alg)
+	if err != nil {
+		return "", err
+	}
+
+	h := hash.New()
+	h.Write([]byte(accessToken))
+
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+// validateAtHash validates the token's at_hash claim against the access token if configured.
+func (a *Auth) validateAtHash(c echo.Context, token *jwt.Token, claims jwt.MapClaims) error {
+	if a.atHashAccessToken == nil {
+		return nil
+	}
+
+	tokenHash, _ := claims["at_hash"].(string)
+	accessToken := a.atHashAccessToken(c)
+
+	if tokenHash == "" || accessToken == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errInvalidAtHash)
+	}
+
+	expected, err := atHash(token.Method.Alg(), accessToken)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(tokenHash)) != 1 {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errInvalidAtHash)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package echojwtx_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestAccessTokenForAtHash(t *testing.T) {
+	accessToken := "test-access-token"
+
+	sum := sha256.Sum256([]byte(accessToken))
+	validHash := base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+
+	testCases := []struct {
+		name             string
+		atHash           string
+		accessToken      string
+		expectStatusCode int
+	}{
+		{
+			"matching at_hash",
+			validHash,
+			accessToken,
+			http.StatusOK,
+		},
+		{
+			"mismatched at_hash",
+			validHash,
+			"other-access-token",
+			http.StatusUnauthorized,
+		},
+		{
+			"missing at_hash",
+			"",
+			accessToken,
+			http.StatusUnauthorized,
+		},
+		{
+			"missing access token",
+			validHash,
+			"",
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				claims := map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+				}
+
+				if tc.atHash != "" {
+					claims["at_hash"] = tc.atHash
+				}
+
+				return claims
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithAccessTokenForAtHash(func(c echo.Context) string {
+					return c.Request().Header.Get("X-Access-Token")
+				}),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", http.Header{
+				"X-Access-Token": []string{tc.accessToken},
+			})
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
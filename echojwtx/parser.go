@@ -0,0 +1,165 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrJWEDecryption is returned when an encrypted token fails to be decrypted.
+	ErrJWEDecryption = errors.New("failed to decrypt jwe token")
+
+	// ErrAlgorithmNone is returned for unsigned tokens using the none algorithm. These tokens are always rejected.
+	ErrAlgorithmNone = errors.New("token uses the none algorithm")
+
+	// ErrUnsupportedCompression is returned for signed tokens with a zip header. Compression is only defined for
+	// encrypted (JWE) tokens, where the decrypter set by WithJWEDecrypter is responsible for inflating the
+	// plaintext. A signed token's signature covers its payload as transmitted, so compressed signed tokens are
+	// always rejected rather than inflated.
+	ErrUnsupportedCompression = errors.New("token uses unsupported compression")
+)
+
+// WithJWEDecrypter sets a function which decrypts an encrypted (JWE) token into its inner signed (JWS) token.
+// The decrypted token still goes through full signature and claims validation.
+// Tokens which fail to decrypt are rejected with a 401.
+func WithJWEDecrypter(fn func(raw string) (string, error)) Opts {
+	return func(a *Auth) {
+		a.jweDecrypter = fn
+	}
+}
+
+// parseToken implements echojwt.Config.ParseTokenFunc, running any configured steps before validating the token.
+// If a ParseTokenFunc was provided in the JWTConfig it is used to validate the token.
+func (a *Auth) parseToken(c echo.Context, raw string) (interface{}, error) {
+	raw, err := a.prepareToken(a.requestLogger(c), raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.parseTokenFunc != nil {
+		return a.parseTokenFunc(c, raw)
+	}
+
+	grace := a.expiryGraceFor(c)
+
+	if a.JWTConfig.NewClaimsFunc != nil {
+		token, err := a.verifyToken(raw, a.JWTConfig.NewClaimsFunc(c), grace)
+		if err != nil {
+			return nil, err
+		}
+
+		return token, nil
+	}
+
+	// only map claims are cached as custom claims may differ per request.
+	if token, ok := a.tokenCache.get(raw, a.now()); ok {
+		return token, nil
+	}
+
+	token, err := a.verifyToken(raw, jwt.MapClaims{}, grace)
+	if err != nil {
+		return nil, err
+	}
+
+	a.tokenCache.add(raw, token, a.now())
+
+	return token, nil
+}
+
+// prepareToken decrypts the raw token if configured and rejects tokens using the none algorithm or compression.
+func (a *Auth) prepareToken(logger *zap.Logger, raw string) (string, error) {
+	if a.jweDecrypter != nil {
+		decrypted, err := a.jweDecrypter(raw)
+		if err != nil {
+			return "", &echojwt.TokenError{Err: fmt.Errorf("%w: %w", ErrJWEDecryption, err)}
+		}
+
+		raw = decrypted
+	}
+
+	header := parseTokenHeader(raw)
+
+	if strings.EqualFold(header.Alg, "none") {
+		logger.Warn("jwt user token uses the none algorithm, possible algorithm stripping attempt", zap.String("alg", header.Alg))
+
+		return "", &echojwt.TokenError{Err: ErrAlgorithmNone}
+	}
+
+	if header.Zip != "" {
+		logger.Warn("jwt user token uses unsupported compression", zap.String("zip", header.Zip))
+
+		return "", &echojwt.TokenError{Err: fmt.Errorf("%w: %q", ErrUnsupportedCompression, header.Zip)}
+	}
+
+	return raw, nil
+}
+
+// verifyToken parses the raw token into claims, validating its signature and registered claims.
+// Tokens are accepted for up to grace after they expire.
+func (a *Auth) verifyToken(raw string, claims jwt.Claims, grace time.Duration) (*jwt.Token, error) {
+	token, err := jwt.ParseWithClaims(raw, claims, a.JWTConfig.KeyFunc, jwt.WithTimeFunc(a.now), jwt.WithLeeway(a.clockSkew+grace))
+	if err != nil {
+		return nil, &echojwt.TokenError{Token: token, Err: err}
+	}
+
+	// the leeway also applies to nbf, which the grace must not extend.
+	if grace > 0 {
+		if nbf, _ := token.Claims.GetNotBefore(); nbf != nil && a.now().Add(a.clockSkew).Before(nbf.Time) {
+			return nil, &echojwt.TokenError{Token: token, Err: jwt.ErrTokenNotValidYet}
+		}
+	}
+
+	if !token.Valid {
+		return nil, &echojwt.TokenError{Token: token, Err: errInvalidToken}
+	}
+
+	return token, nil
+}
+
+// tokenHeader is the subset of a token's header inspected before the token is validated.
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Zip string `json:"zip"`
+}
+
+// parseTokenHeader returns the header of the raw token without validating it.
+// An empty header is returned if the header can't be decoded.
+func parseTokenHeader(raw string) tokenHeader {
+	segment, _, _ := strings.Cut(raw, ".")
+
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return tokenHeader{}
+	}
+
+	var header tokenHeader
+
+	if err := json.Unmarshal(data, &header); err != nil {
+		return tokenHeader{}
+	}
+
+	return header
+}
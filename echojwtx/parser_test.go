@@ -0,0 +1,243 @@
+package echojwtx_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestJWEDecrypter(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	signer := testHelperMustMakeSigner(jose.RS256, TestPrivRSAKey1ID, TestPrivRSAKey1)
+
+	signed, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Issuer:  issuer,
+		Subject: "urn:test:user",
+	}).CompactSerialize()
+
+	require.NoError(t, err, "no error expected signing token")
+
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{
+		Algorithm: jose.RSA_OAEP_256,
+		Key:       &TestPrivRSAKey2.PublicKey,
+	}, (&jose.EncrypterOptions{}).WithContentType("JWT"))
+
+	require.NoError(t, err, "no error expected creating encrypter")
+
+	encryptedObj, err := encrypter.Encrypt([]byte(signed))
+
+	require.NoError(t, err, "no error expected encrypting token")
+
+	encrypted, err := encryptedObj.CompactSerialize()
+
+	require.NoError(t, err, "no error expected serializing encrypted token")
+
+	errDecrypt := errors.New("decrypt failed")
+
+	testCases := []struct {
+		name             string
+		token            string
+		decrypter        func(raw string) (string, error)
+		expectStatusCode int
+	}{
+		{
+			"decrypted",
+			encrypted,
+			func(raw string) (string, error) {
+				obj, err := jose.ParseEncrypted(raw)
+				if err != nil {
+					return "", err
+				}
+
+				inner, err := obj.Decrypt(TestPrivRSAKey2)
+				if err != nil {
+					return "", err
+				}
+
+				return string(inner), nil
+			},
+			http.StatusOK,
+		},
+		{
+			"decrypt failure",
+			encrypted,
+			func(raw string) (string, error) {
+				return "", errDecrypt
+			},
+			http.StatusUnauthorized,
+		},
+		{
+			"invalid inner token",
+			encrypted,
+			func(raw string) (string, error) {
+				return "invalid", nil
+			},
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithJWEDecrypter(tc.decrypter),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, http.DefaultClient, auth.Middleware(), http.MethodGet, "/test", http.Header{
+				echo.HeaderAuthorization: []string{"Bearer " + tc.token},
+			})
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestAlgorithmNone(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"` + issuer + `","sub":"urn:test:user"}`))
+	token := header + "." + payload + "."
+
+	testCases := []struct {
+		name      string
+		jwtConfig echojwt.Config
+	}{
+		{
+			"default parser",
+			echojwt.Config{},
+		},
+		{
+			"custom parser",
+			echojwt.Config{
+				ParseTokenFunc: func(_ echo.Context, _ string) (interface{}, error) {
+					return &gojwt.Token{Valid: true, Claims: gojwt.MapClaims{"iss": issuer, "sub": "urn:test:user"}}, nil
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var handledErr error
+
+			tc.jwtConfig.ErrorHandler = func(_ echo.Context, err error) error {
+				handledErr = err
+
+				return echo.NewHTTPError(http.StatusUnauthorized).SetInternal(err)
+			}
+
+			core, logs := observer.New(zapcore.DebugLevel)
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithJWTConfig(tc.jwtConfig),
+				echojwtx.WithLogger(zap.New(core)),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, "expected 401 response from test server")
+			assert.ErrorIs(t, handledErr, echojwtx.ErrAlgorithmNone, "expected none algorithm error")
+
+			entries := logs.FilterLevelExact(zapcore.WarnLevel).FilterField(zap.String("alg", "none")).All()
+
+			assert.Len(t, entries, 1, "expected none algorithm warning")
+		})
+	}
+}
+
+func TestUnsupportedCompression(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	var payload bytes.Buffer
+
+	w, err := flate.NewWriter(&payload, flate.BestCompression)
+	require.NoError(t, err, "no error expected creating deflate writer")
+
+	_, err = w.Write([]byte(`{"iss":"` + issuer + `","sub":"urn:test:user"}`))
+	require.NoError(t, err, "no error expected compressing payload")
+	require.NoError(t, w.Close(), "no error expected compressing payload")
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"` + TestPrivRSAKey1ID + `","zip":"DEF"}`))
+	signingString := header + "." + base64.RawURLEncoding.EncodeToString(payload.Bytes())
+
+	signature, err := gojwt.SigningMethodRS256.Sign(signingString, TestPrivRSAKey1)
+	require.NoError(t, err, "no error expected signing token")
+
+	token := signingString + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	var handledErr error
+
+	auth, err := echojwtx.NewAuth(context.Background(),
+		echojwtx.AuthConfig{
+			Issuer: issuer,
+		},
+		echojwtx.WithReasonHeader("X-Auth-Reason"),
+		echojwtx.WithJWTConfig(echojwt.Config{
+			ErrorHandler: func(_ echo.Context, err error) error {
+				handledErr = err
+
+				return echo.NewHTTPError(http.StatusUnauthorized).SetInternal(err)
+			},
+		}),
+	)
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", token))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "expected 401 response from test server")
+	assert.ErrorIs(t, handledErr, echojwtx.ErrUnsupportedCompression, "expected unsupported compression error")
+	assert.Equal(t, echojwtx.ReasonMalformedToken, rec.Header().Get("X-Auth-Reason"), "unexpected reason")
+}
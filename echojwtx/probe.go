@@ -0,0 +1,172 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/exp/slices"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// maxJWKSDocumentSize limits the size of the JWKS read from the issuer while probing.
+const maxJWKSDocumentSize = 1 << 20
+
+// ErrJWKSStatus is returned by Probe when the JWKS endpoint responds with a non 200 status code.
+var ErrJWKSStatus = errors.New("unexpected jwks response status")
+
+// ProbeResult describes the discovery document and JWKS served by an issuer.
+type ProbeResult struct {
+	// Issuer is the probed issuer.
+	Issuer string
+
+	// JWKSURI is the jwks_uri resolved from the issuer's oidc well-known configuration.
+	JWKSURI string
+
+	// KeyCount is the number of keys in the JWKS, excluding keys which couldn't be parsed.
+	KeyCount int
+
+	// Algorithms are the distinct signing algorithms of the keys in the JWKS.
+	Algorithms []string
+
+	// SupportedAlgorithms are the signing algorithms advertised by the discovery document's
+	// id_token_signing_alg_values_supported field.
+	SupportedAlgorithms []string
+
+	// Warnings are non fatal problems found with the configuration, such as keys using unsupported algorithms or
+	// keys which couldn't be parsed.
+	Warnings []string
+}
+
+// Probe verifies the configured issuer serves a valid oidc well-known configuration and JWKS without
+// constructing an Auth, making it suitable for preflight checks. The RefreshTimeout of the config, if set,
+// bounds the entire probe. An error is returned if the discovery document or JWKS can't be fetched or parsed.
+func Probe(ctx context.Context, config AuthConfig) (ProbeResult, error) {
+	result := ProbeResult{
+		Issuer: config.Issuer,
+	}
+
+	if config.RefreshTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, config.RefreshTimeout)
+		defer cancel()
+	}
+
+	discovery, err := discover(ctx, jwksClient, config.Issuer, nil, false)
+	if err != nil {
+		return result, err
+	}
+
+	result.JWKSURI = discovery.JWKSURI
+	result.SupportedAlgorithms = discovery.SupportedAlgorithms
+
+	if !jsonContentType(discovery.ContentType) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("discovery document content type %q is not json", discovery.ContentType))
+	}
+
+	switch {
+	case discovery.Issuer == "":
+		result.Warnings = append(result.Warnings, "discovery document does not specify an issuer")
+	case normalizeIssuer(discovery.Issuer) != normalizeIssuer(config.Issuer):
+		result.Warnings = append(result.Warnings, fmt.Sprintf("discovery document issuer %q does not match", discovery.Issuer))
+	}
+
+	rawKeys, err := fetchJWKS(ctx, jwksClient, discovery.JWKSURI)
+	if err != nil {
+		return result, err
+	}
+
+	if len(rawKeys) == 0 {
+		result.Warnings = append(result.Warnings, "jwks contains no keys")
+	}
+
+	for i, raw := range rawKeys {
+		var key jose.JSONWebKey
+
+		// keys of types go-jose doesn't support are skipped so they don't fail the whole probe.
+		if err := key.UnmarshalJSON(raw); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("key %d could not be parsed: %s", i, err))
+
+			continue
+		}
+
+		result.KeyCount++
+
+		switch {
+		case key.Algorithm == "":
+			result.Warnings = append(result.Warnings, fmt.Sprintf("key %q does not specify an algorithm", key.KeyID))
+		case jwt.GetSigningMethod(key.Algorithm) == nil:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("key %q uses unsupported algorithm %q", key.KeyID, key.Algorithm))
+		}
+
+		if key.Algorithm != "" && !slices.Contains(result.Algorithms, key.Algorithm) {
+			result.Algorithms = append(result.Algorithms, key.Algorithm)
+		}
+	}
+
+	if len(result.SupportedAlgorithms) != 0 {
+		for _, alg := range result.Algorithms {
+			if !slices.Contains(result.SupportedAlgorithms, alg) {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("key algorithm %q is not advertised by the discovery document", alg))
+			}
+		}
+	}
+
+	if config.Audience == "" {
+		result.Warnings = append(result.Warnings, "no audience configured, tokens for any audience are accepted")
+	}
+
+	return result, nil
+}
+
+// fetchJWKS fetches the JWKS at the provided uri, returning its keys without parsing them.
+func fetchJWKS(ctx context.Context, client *http.Client, uri string) ([]json.RawMessage, error) {
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close() //nolint:errcheck // no need to check
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d", ErrJWKSStatus, res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxJWKSDocumentSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return nil, err
+	}
+
+	return jwks.Keys, nil
+}
@@ -0,0 +1,166 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestProbe(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID, TestPrivRSAKey2ID)
+	defer closer()
+
+	result, err := echojwtx.Probe(context.Background(), echojwtx.AuthConfig{
+		Issuer:   issuer,
+		Audience: "testaud",
+	})
+
+	require.NoError(t, err, "no error expected for Probe")
+
+	assert.Equal(t, issuer, result.Issuer, "unexpected issuer")
+	assert.Equal(t, issuer+"/.well-known/jwks.json", result.JWKSURI, "unexpected jwks uri")
+	assert.Equal(t, 2, result.KeyCount, "unexpected key count")
+	assert.Len(t, result.Warnings, 2, "expected a warning for each key without an algorithm")
+}
+
+func TestProbeAlgorithms(t *testing.T) {
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"issuer": srv.URL, "jwks_uri": srv.URL + "/jwks.json"})
+	})
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		key := testHelperJoseJWKSProvider(TestPrivRSAKey1ID, TestPrivRSAKey2ID)
+		key.Keys[0].Algorithm = "RS256"
+		key.Keys[1].Algorithm = "XX999"
+
+		return c.JSON(http.StatusOK, key)
+	})
+
+	result, err := echojwtx.Probe(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	})
+
+	require.NoError(t, err, "no error expected for Probe")
+
+	assert.Equal(t, 2, result.KeyCount, "unexpected key count")
+	assert.Equal(t, []string{"RS256", "XX999"}, result.Algorithms, "unexpected algorithms")
+	assert.Equal(t, []string{
+		`key "` + TestPrivRSAKey2ID + `" uses unsupported algorithm "XX999"`,
+		"no audience configured, tokens for any audience are accepted",
+	}, result.Warnings, "unexpected warnings")
+}
+
+func TestProbeSupportedAlgorithms(t *testing.T) {
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{
+			"issuer":                                srv.URL,
+			"jwks_uri":                              srv.URL + "/jwks.json",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		key := testHelperJoseJWKSProvider(TestPrivRSAKey1ID, TestPrivRSAKey2ID)
+		key.Keys[0].Algorithm = "RS256"
+		key.Keys[1].Algorithm = "PS256"
+
+		return c.JSON(http.StatusOK, key)
+	})
+
+	result, err := echojwtx.Probe(context.Background(), echojwtx.AuthConfig{
+		Issuer:   srv.URL,
+		Audience: "testaud",
+	})
+
+	require.NoError(t, err, "no error expected for Probe")
+
+	assert.Equal(t, []string{"RS256"}, result.SupportedAlgorithms, "unexpected supported algorithms")
+	assert.Equal(t, []string{
+		`key algorithm "PS256" is not advertised by the discovery document`,
+	}, result.Warnings, "unexpected warnings")
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	})
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	assert.Equal(t, []string{"RS256"}, auth.SupportedAlgorithms(), "unexpected supported algorithms")
+}
+
+func TestProbeErrors(t *testing.T) {
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	e.GET("/missing/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{})
+	})
+
+	e.GET("/unavailable/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"jwks_uri": srv.URL + "/unavailable/jwks.json"})
+	})
+
+	e.GET("/unavailable/jwks.json", func(c echo.Context) error {
+		return c.NoContent(http.StatusServiceUnavailable)
+	})
+
+	_, err := echojwtx.Probe(context.Background(), echojwtx.AuthConfig{Issuer: srv.URL + "/missing"})
+	assert.ErrorIs(t, err, echojwtx.ErrJWKSURIMissing, "expected missing jwks_uri error")
+
+	_, err = echojwtx.Probe(context.Background(), echojwtx.AuthConfig{Issuer: srv.URL + "/unavailable"})
+	assert.ErrorIs(t, err, echojwtx.ErrJWKSStatus, "expected jwks status error")
+}
+
+func TestProbeTolerance(t *testing.T) {
+	e := echo.New()
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"issuer": srv.URL + "/", "jwks_uri": srv.URL + "/jwks.json"})
+	})
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		key := testHelperJoseJWKSProvider(TestPrivRSAKey1ID)
+		key.Keys[0].Algorithm = "RS256"
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"keys": []interface{}{
+				key.Keys[0],
+				echo.Map{"kty": "XYZ", "kid": "unsupported"},
+			},
+		})
+	})
+
+	result, err := echojwtx.Probe(context.Background(), echojwtx.AuthConfig{
+		Issuer:   srv.URL,
+		Audience: "testaud",
+	})
+
+	require.NoError(t, err, "no error expected for Probe with an unsupported key type")
+
+	assert.Equal(t, 1, result.KeyCount, "expected unsupported key to be skipped")
+	assert.Equal(t, []string{"RS256"}, result.Algorithms, "unexpected algorithms")
+	require.Len(t, result.Warnings, 1, "expected only a warning for the skipped key, not the trailing slash issuer")
+	assert.Contains(t, result.Warnings[0], "key 1 could not be parsed", "unexpected warning")
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+)
+
+var errInsufficientScope = errors.New("insufficient scope")
+
+// WithRequiredScopes rejects tokens which were not granted all of the provided scopes with a 403.
+// Scopes are read from the space delimited scope claim, or the scp claim if scope is not present.
+// See WithScopeSeparator for providers which delimit scopes differently.
+func WithRequiredScopes(scopes ...string) Opts {
+	return func(a *Auth) {
+		a.requiredScopes = scopes
+	}
+}
+
+// WithAnyScope rejects tokens which were not granted at least one of the provided scopes with a 403.
+// When combined with WithRequiredScopes a token must be granted every required scope and at least one of the
+// provided scopes, for example required scopes "tenant" with any scope "read:x" or "admin" accepts a token with
+// the scopes "tenant admin" but not "admin" or "tenant".
+func WithAnyScope(scopes ...string) Opts {
+	return func(a *Auth) {
+		a.anyScopes = scopes
+	}
+}
+
+// WithScopeSeparator sets the separator the scope claim is split on, for providers which delimit scopes with
+// a character other than a space, such as a comma. Whitespace around each scope is ignored. The scp claim is
+// not affected. By default the scope claim is split on whitespace.
+func WithScopeSeparator(sep string) Opts {
+	return func(a *Auth) {
+		a.scopeSeparator = sep
+	}
+}
+
+// tokenScopes returns the scopes granted to the token using the configured scope separator.
+func (a *Auth) tokenScopes(claims jwt.MapClaims) []string {
+	return claimScopes(claims, a.scopeSeparator)
+}
+
+// validateScopes validates the token was granted all required scopes and at least one of the any scopes.
+func (a *Auth) validateScopes(c echo.Context, claims jwt.MapClaims) error {
+	if len(a.requiredScopes) == 0 && len(a.anyScopes) == 0 {
+		return nil
+	}
+
+	scopes := a.tokenScopes(claims)
+
+	for _, scope := range a.requiredScopes {
+		if !slices.Contains(scopes, scope) {
+			a.requestLogger(c).Error("jwt user missing required scope", zap.String("scope", scope))
+
+			return echo.NewHTTPError(http.StatusForbidden, "insufficient scope").SetInternal(errInsufficientScope)
+		}
+	}
+
+	if len(a.anyScopes) == 0 {
+		return nil
+	}
+
+	for _, scope := range a.anyScopes {
+		if slices.Contains(scopes, scope) {
+			return nil
+		}
+	}
+
+	a.requestLogger(c).Error("jwt user missing any of the required scopes", zap.Strings("scopes", a.anyScopes))
+
+	return echo.NewHTTPError(http.StatusForbidden, "insufficient scope").SetInternal(errInsufficientScope)
+}
+
+// RequireScopes returns middleware which rejects requests whose token was not granted all of the provided
+// scopes with a 403. It's intended for individual routes or groups and must run after Middleware, requests
+// without an authenticated Identity, such as those skipped by the JWTConfig Skipper, are rejected with a 401.
+func (a *Auth) RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			identity, ok := IdentityFromContext(c.Request().Context())
+			if !ok {
+				a.requestLogger(c).Error("jwt user not authenticated for required scopes")
+
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing or malformed jwt").SetInternal(ErrMissingAuthorization)
+			}
+
+			for _, scope := range scopes {
+				if !identity.HasScope(scope) {
+					a.requestLogger(c).Error("jwt user missing required route scope", zap.String("scope", scope))
+
+					if a.reasonHeader != "" {
+						c.Response().Header().Set(a.reasonHeader, ReasonInsufficientScope)
+					}
+
+					setInsufficientScopeChallenge(c, errInsufficientScope)
+
+					return echo.NewHTTPError(http.StatusForbidden, "insufficient scope").SetInternal(errInsufficientScope)
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestRequiredScopes(t *testing.T) {
+	testCases := []struct {
+		name             string
+		scopes           map[string]interface{}
+		expectStatusCode int
+	}{
+		{
+			"all scopes",
+			map[string]interface{}{"scope": "read write"},
+			http.StatusOK,
+		},
+		{
+			"all scopes scp",
+			map[string]interface{}{"scp": []string{"read", "write"}},
+			http.StatusOK,
+		},
+		{
+			"missing scope",
+			map[string]interface{}{"scope": "read"},
+			http.StatusForbidden,
+		},
+		{
+			"no scopes",
+			nil,
+			http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				claims := map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+				}
+
+				for key, value := range tc.scopes {
+					claims[key] = value
+				}
+
+				return claims
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, echojwtx.WithRequiredScopes("read", "write"))
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithJWTConfig(echojwt.Config{
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/public"
+		},
+	}))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	handler := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	e.GET("/read", handler, auth.RequireScopes("read"))
+	e.GET("/write", handler, auth.RequireScopes("read", "write"))
+	e.GET("/public", handler, auth.RequireScopes("read"))
+
+	token := testHelperMustSignClaims(map[string]interface{}{"iss": issuer, "sub": "urn:test:user", "scope": "read"})
+
+	testCases := []struct {
+		name             string
+		path             string
+		token            string
+		expectStatusCode int
+	}{
+		{
+			"granted scope",
+			"/read",
+			token,
+			http.StatusOK,
+		},
+		{
+			"missing scope",
+			"/write",
+			token,
+			http.StatusForbidden,
+		},
+		{
+			"unauthenticated",
+			"/public",
+			"",
+			http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, tc.path, tc.token))
+
+			assert.Equal(t, tc.expectStatusCode, rec.Code, "unexpected response status")
+		})
+	}
+}
+
+func TestScopeSeparator(t *testing.T) {
+	testCases := []struct {
+		name             string
+		separator        string
+		scopes           map[string]interface{}
+		expectStatusCode int
+	}{
+		{
+			"comma delimited",
+			",",
+			map[string]interface{}{"scope": "read, write"},
+			http.StatusOK,
+		},
+		{
+			"comma delimited missing scope",
+			",",
+			map[string]interface{}{"scope": "read,admin"},
+			http.StatusForbidden,
+		},
+		{
+			"comma separator with space delimited",
+			",",
+			map[string]interface{}{"scope": "read write"},
+			http.StatusForbidden,
+		},
+		{
+			"comma separator with scp array",
+			",",
+			map[string]interface{}{"scp": []string{"read", "write"}},
+			http.StatusOK,
+		},
+		{
+			"default separator with comma delimited",
+			"",
+			map[string]interface{}{"scope": "read,write"},
+			http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				claims := map[string]interface{}{
+					"iss": issuer,
+					"sub": "urn:test:user",
+				}
+
+				for key, value := range tc.scopes {
+					claims[key] = value
+				}
+
+				return claims
+			})
+			defer closer()
+
+			options := []echojwtx.Opts{echojwtx.WithRequiredScopes("read", "write")}
+
+			if tc.separator != "" {
+				options = append(options, echojwtx.WithScopeSeparator(tc.separator))
+			}
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, options...)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
+
+func TestAnyScope(t *testing.T) {
+	testCases := []struct {
+		name             string
+		required         []string
+		any              []string
+		scope            string
+		expectStatusCode int
+	}{
+		{
+			"any scope first",
+			nil,
+			[]string{"read:x", "admin"},
+			"read:x",
+			http.StatusOK,
+		},
+		{
+			"any scope second",
+			nil,
+			[]string{"read:x", "admin"},
+			"other admin",
+			http.StatusOK,
+		},
+		{
+			"any scope none",
+			nil,
+			[]string{"read:x", "admin"},
+			"other",
+			http.StatusForbidden,
+		},
+		{
+			"required and any scope",
+			[]string{"tenant"},
+			[]string{"read:x", "admin"},
+			"tenant admin",
+			http.StatusOK,
+		},
+		{
+			"required without any scope",
+			[]string{"tenant"},
+			[]string{"read:x", "admin"},
+			"tenant",
+			http.StatusForbidden,
+		},
+		{
+			"any scope without required",
+			[]string{"tenant"},
+			[]string{"read:x", "admin"},
+			"admin",
+			http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oauthClient, issuer, closer := testHelperOAuthClient(func(issuer string) map[string]interface{} {
+				return map[string]interface{}{
+					"iss":   issuer,
+					"sub":   "urn:test:user",
+					"scope": tc.scope,
+				}
+			})
+			defer closer()
+
+			auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+				Issuer: issuer,
+			}, echojwtx.WithRequiredScopes(tc.required...), echojwtx.WithAnyScope(tc.any...))
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			statusCode := testHelperDoRequest(t, oauthClient, auth.Middleware(), http.MethodGet, "/test", nil)
+
+			assert.Equalf(t, tc.expectStatusCode, statusCode, "expected %d response from test server", tc.expectStatusCode)
+		})
+	}
+}
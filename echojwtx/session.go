@@ -0,0 +1,64 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	errSessionMismatch = errors.New("token session does not match session cookie")
+	errSessionUnknown  = errors.New("token session is unknown")
+)
+
+// WithSessionBinding rejects tokens whose sid claim doesn't match the session id in the cookie with the provided
+// name with a 401, binding browser access tokens to the session they were issued for. Requests without the cookie
+// and tokens without a sid claim are rejected. If sessionLookup is not nil it must also report the session as
+// active in the server-side session store.
+func WithSessionBinding(cookieName string, sessionLookup func(sid string) bool) Opts {
+	return func(a *Auth) {
+		a.sessionCookie = cookieName
+		a.sessionLookup = sessionLookup
+	}
+}
+
+// validateSessionBinding validates the token sid claim matches the session cookie and an active session.
+func (a *Auth) validateSessionBinding(c echo.Context, claims jwt.MapClaims) error {
+	if a.sessionCookie == "" {
+		return nil
+	}
+
+	sid, _ := claims["sid"].(string)
+
+	cookie, err := c.Cookie(a.sessionCookie)
+	if err != nil || sid == "" || subtle.ConstantTimeCompare([]byte(sid), []byte(cookie.Value)) != 1 {
+		a.requestLogger(c).Error("jwt user claim sid does not match session cookie")
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errSessionMismatch)
+	}
+
+	if a.sessionLookup != nil && !a.sessionLookup(sid) {
+		a.requestLogger(c).Error("jwt user claim sid is not an active session")
+
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid or expired jwt").SetInternal(errSessionUnknown)
+	}
+
+	return nil
+}
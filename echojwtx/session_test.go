@@ -0,0 +1,103 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestSessionBinding(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	sessions := map[string]bool{
+		"session-1": true,
+		"session-2": false,
+	}
+
+	testCases := []struct {
+		name             string
+		sid              interface{}
+		cookie           string
+		expectStatusCode int
+	}{
+		{
+			"matched session",
+			"session-1",
+			"session-1",
+			http.StatusOK,
+		},
+		{
+			"mismatched session",
+			"session-1",
+			"session-3",
+			http.StatusUnauthorized,
+		},
+		{
+			"missing session cookie",
+			"session-1",
+			"",
+			http.StatusUnauthorized,
+		},
+		{
+			"missing sid claim",
+			nil,
+			"session-1",
+			http.StatusUnauthorized,
+		},
+		{
+			"inactive session",
+			"session-2",
+			"session-2",
+			http.StatusUnauthorized,
+		},
+	}
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: issuer,
+	}, echojwtx.WithSessionBinding("session", func(sid string) bool {
+		return sessions[sid]
+	}))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	e := echo.New()
+
+	e.Use(auth.Middleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := map[string]interface{}{
+				"iss": issuer,
+				"sub": "urn:test:user",
+			}
+
+			if tc.sid != nil {
+				claims["sid"] = tc.sid
+			}
+
+			req := testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(claims))
+
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "session", Value: tc.cookie})
+			}
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectStatusCode, rec.Code, "unexpected status code")
+		})
+	}
+}
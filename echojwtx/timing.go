@@ -0,0 +1,69 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// validationStartKey defines the echo context key the time validation started is stored in.
+const validationStartKey = "echojwtx.validation_start"
+
+// WithSlowValidationThreshold calls fn whenever validating a request, including parsing the token, resolving
+// the key with any synchronous JWKS refresh and validating the claims, takes longer than the threshold.
+// fn is called for both accepted and rejected requests before the response is written and can't change the
+// response, it should return quickly as it adds to the request latency.
+//
+// The measured duration is also recorded on the span in the request context, if any, as the
+// echojwtx.validation.duration_ms attribute.
+func WithSlowValidationThreshold(d time.Duration, fn func(c echo.Context, took time.Duration)) Opts {
+	return func(a *Auth) {
+		a.slowValidationThreshold = d
+		a.slowValidation = fn
+	}
+}
+
+// startValidation records the time validation of the request started if validation timing is enabled.
+func (a *Auth) startValidation(c echo.Context) {
+	if a.slowValidation != nil {
+		c.Set(validationStartKey, time.Now())
+	}
+}
+
+// finishValidation records the validation duration of the request, calling the slow validation callback if
+// the threshold was exceeded.
+func (a *Auth) finishValidation(c echo.Context) {
+	start, ok := c.Get(validationStartKey).(time.Time)
+	if !ok {
+		return
+	}
+
+	// ensure the validation is only recorded once
+	c.Set(validationStartKey, nil)
+
+	took := time.Since(start)
+
+	trace.SpanFromContext(c.Request().Context()).SetAttributes(
+		attribute.Float64("echojwtx.validation.duration_ms", float64(took)/float64(time.Millisecond)),
+	)
+
+	if took > a.slowValidationThreshold {
+		a.slowValidation(c, took)
+	}
+}
@@ -0,0 +1,116 @@
+package echojwtx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestSlowValidationThreshold(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	validToken := testHelperMustSignClaims(map[string]interface{}{
+		"iss": issuer,
+		"sub": "urn:test:user",
+	})
+
+	testCases := []struct {
+		name             string
+		threshold        time.Duration
+		token            string
+		expectStatusCode int
+		expectSlow       bool
+	}{
+		{
+			"under threshold",
+			time.Hour,
+			validToken,
+			http.StatusOK,
+			false,
+		},
+		{
+			"over threshold",
+			0,
+			validToken,
+			http.StatusOK,
+			true,
+		},
+		{
+			"over threshold rejected",
+			0,
+			"not-a-token",
+			http.StatusUnauthorized,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+
+			auth, err := echojwtx.NewAuth(context.Background(),
+				echojwtx.AuthConfig{
+					Issuer: issuer,
+				},
+				echojwtx.WithSlowValidationThreshold(tc.threshold, func(_ echo.Context, took time.Duration) {
+					calls++
+
+					assert.Greater(t, took, tc.threshold, "expected duration over threshold")
+				}),
+			)
+
+			require.NoError(t, err, "no error expected for NewAuth")
+
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			e := echo.New()
+
+			e.Use(auth.Middleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+
+			ctx, span := provider.Tracer("test").Start(context.Background(), "request")
+
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", tc.token).WithContext(ctx))
+
+			span.End()
+
+			assert.Equalf(t, tc.expectStatusCode, rec.Code, "expected %d response from test server", tc.expectStatusCode)
+
+			if tc.expectSlow {
+				assert.Equal(t, 1, calls, "expected slow validation callback")
+			} else {
+				assert.Zero(t, calls, "expected no slow validation callback")
+			}
+
+			spans := recorder.Ended()
+			require.Len(t, spans, 1, "expected recorded span")
+
+			var found bool
+
+			for _, attr := range spans[0].Attributes() {
+				if attr.Key == "echojwtx.validation.duration_ms" {
+					found = true
+				}
+			}
+
+			assert.True(t, found, "expected validation duration span attribute")
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// ErrRootCAsWithHTTPClient is returned when root CAs are configured along with a custom http client, as the
+// custom client's transport determines which certificates are trusted.
+var ErrRootCAsWithHTTPClient = errors.New("root cas can't be combined with a custom http client")
+
+// WithRootCAs trusts the provided certificate pool, in place of the system roots, for discovery and JWKS requests
+// made by the auth middleware, such as for an issuer using a certificate signed by a private CA. The pool only
+// applies to these requests, no global http client or transport is changed.
+//
+// NewAuth fails with ErrRootCAsWithHTTPClient if a custom client is also set with WithIssuerHTTPClient or
+// the KeyFuncOptions client, configure the client's transport to trust the pool instead.
+func WithRootCAs(pool *x509.CertPool) Opts {
+	return func(a *Auth) {
+		a.rootCAs = pool
+	}
+}
+
+// setupRootCAs builds the http client trusting the configured root CAs and uses it for JWKS requests.
+func (a *Auth) setupRootCAs() error {
+	if a.rootCAs == nil {
+		return nil
+	}
+
+	if len(a.issuerHTTPClients) != 0 || a.KeyFuncOptions.Client != nil {
+		return ErrRootCAsWithHTTPClient
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    a.rootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	a.rootCAClient = &http.Client{
+		Timeout:   jwksClient.Timeout,
+		Transport: otelhttp.NewTransport(transport),
+	}
+
+	a.KeyFuncOptions.Client = a.rootCAClient
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package echojwtx_test
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestRootCAs(t *testing.T) {
+	e := echo.New()
+
+	srv := httptest.NewTLSServer(e)
+	defer srv.Close()
+
+	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, echo.Map{"issuer": srv.URL, "jwks_uri": srv.URL + "/jwks.json"})
+	})
+
+	e.GET("/jwks.json", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, testHelperJoseJWKSProvider(TestPrivRSAKey1ID))
+	})
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	_, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	})
+
+	require.Error(t, err, "expected error for issuer with untrusted certificate")
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	}, echojwtx.WithRootCAs(pool))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	router := echo.New()
+
+	router.Use(auth.Middleware())
+
+	router.GET("/test", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+
+	router.ServeHTTP(rec, testHelperRequest(http.MethodGet, "/test", testHelperMustSignClaims(map[string]interface{}{
+		"iss": srv.URL,
+		"sub": "urn:test:user",
+	})))
+
+	assert.Equal(t, http.StatusOK, rec.Code, "expected 200 response from test server")
+
+	_, err = echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer: srv.URL,
+	}, echojwtx.WithRootCAs(pool), echojwtx.WithIssuerHTTPClient(srv.URL, srv.Client()))
+
+	assert.ErrorIs(t, err, echojwtx.ErrRootCAsWithHTTPClient, "expected error combining root cas with a custom client")
+}
@@ -8,10 +8,14 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"sync"
+	"sync/atomic"
+	"testing"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
 	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
@@ -70,8 +74,20 @@ func testHelperJoseJWKSProvider(keyIDs ...string) jose.JSONWebKeySet {
 	}
 }
 
-// testHelperOIDCProvider returns an issuer and a close function.
-func testHelperOIDCProvider(keyIDs ...string) (string, func()) {
+// testOIDCProvider is a test oidc provider whose served keys may be changed while running.
+type testOIDCProvider struct {
+	issuer string
+	server *http.Server
+
+	mu        sync.Mutex
+	keyIDs    []string
+	jwksDelay time.Duration
+
+	jwksRequests atomic.Int32
+}
+
+// newTestOIDCProvider starts a new test oidc provider serving the provided key ids.
+func newTestOIDCProvider(keyIDs ...string) *testOIDCProvider {
 	e := echo.New()
 
 	listener, err := net.Listen("tcp", ":0")
@@ -79,35 +95,69 @@ func testHelperOIDCProvider(keyIDs ...string) (string, func()) {
 		panic(err)
 	}
 
-	s := &http.Server{
-		Handler: e,
+	p := &testOIDCProvider{
+		issuer: fmt.Sprintf("http://localhost:%d", listener.Addr().(*net.TCPAddr).Port),
+		server: &http.Server{
+			Handler: e,
+		},
+		keyIDs: keyIDs,
 	}
 
-	issuer := fmt.Sprintf("http://localhost:%d", listener.Addr().(*net.TCPAddr).Port)
-
-	keySet := testHelperJoseJWKSProvider(keyIDs...)
-
 	e.GET("/.well-known/openid-configuration", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, echo.Map{
-			"jwks_uri": fmt.Sprintf(issuer + "/.well-known/jwks.json"),
+			"issuer":   p.issuer,
+			"jwks_uri": fmt.Sprintf(p.issuer + "/.well-known/jwks.json"),
 		})
 	})
 
 	e.GET("/.well-known/jwks.json", func(c echo.Context) error {
+		p.jwksRequests.Add(1)
+
+		p.mu.Lock()
+		keySet := testHelperJoseJWKSProvider(p.keyIDs...)
+		delay := p.jwksDelay
+		p.mu.Unlock()
+
+		time.Sleep(delay)
+
 		return c.JSON(http.StatusOK, keySet)
 	})
 
 	go func() {
-		if err := s.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := p.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			panic(err)
 		}
 	}()
 
-	closer := func() {
-		s.Close() //nolint:errcheck // error check not needed
-	}
+	return p
+}
+
+// SetKeyIDs changes the key ids served by the provider.
+func (p *testOIDCProvider) SetKeyIDs(keyIDs ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keyIDs = keyIDs
+}
+
+// SetJWKSDelay delays the provider's JWKS responses by the provided duration.
+func (p *testOIDCProvider) SetJWKSDelay(delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.jwksDelay = delay
+}
 
-	return issuer, closer
+// Close stops the provider.
+func (p *testOIDCProvider) Close() {
+	p.server.Close() //nolint:errcheck // error check not needed
+}
+
+// testHelperOIDCProvider returns an issuer and a close function.
+func testHelperOIDCProvider(keyIDs ...string) (string, func()) {
+	p := newTestOIDCProvider(keyIDs...)
+
+	return p.issuer, p.Close
 }
 
 // testHelperGetToken will return a signed token
@@ -151,3 +201,90 @@ func OAuthTestClient(subject string, audience string) (*http.Client, string, fun
 		AccessToken: rawToken,
 	})), issuer, closer
 }
+
+// testHelperDoRequest sends a request with the provided method and headers to an echo server using the provided
+// middleware and returns the response status code.
+func testHelperDoRequest(t *testing.T, client *http.Client, mdw echo.MiddlewareFunc, method, path string, headers http.Header) int {
+	t.Helper()
+
+	e := echo.New()
+
+	e.Use(mdw)
+
+	e.Any("/*", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	srv := httptest.NewServer(e)
+
+	defer srv.Close()
+
+	req, err := http.NewRequestWithContext(context.TODO(), method, srv.URL+path, nil)
+	require.NoError(t, err, "expected new request without error")
+
+	for key, values := range headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	require.NoError(t, err, "expected response without error")
+
+	_ = resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+// testHelperOAuthClient creates a new http client handling OAuth automatically with a token containing the claims
+// returned by claimsFn. claimsFn is provided the issuer of the test provider.
+// Returned is the new HTTP Client, OIDC URI and a close function.
+func testHelperOAuthClient(claimsFn func(issuer string) map[string]interface{}) (*http.Client, string, func()) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID, TestPrivRSAKey2ID)
+
+	signer := testHelperMustMakeSigner(jose.RS256, TestPrivRSAKey1ID, TestPrivRSAKey1)
+
+	rawToken, err := jwt.Signed(signer).Claims(claimsFn(issuer)).CompactSerialize()
+	if err != nil {
+		panic(err)
+	}
+
+	return oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{
+		AccessToken: rawToken,
+	})), issuer, closer
+}
+
+// countingTransport counts the requests made through it.
+type countingTransport struct {
+	count atomic.Int32
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.count.Add(1)
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// testHelperRequest returns a new test request with the provided bearer token.
+func testHelperRequest(method, target, token string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+
+	return req
+}
+
+// testHelperMustSignClaims returns a token with the provided claims signed by TestPrivRSAKey1.
+func testHelperMustSignClaims(claims map[string]interface{}) string {
+	signer := testHelperMustMakeSigner(jose.RS256, TestPrivRSAKey1ID, TestPrivRSAKey1)
+
+	raw, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		panic(err)
+	}
+
+	return raw
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 The Infratographer Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package echojwtx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrNoIdentity is returned by ValidateIdentity when the token was accepted without authenticating an identity,
+// such as when the middleware is configured to never reject requests.
+var ErrNoIdentity = errors.New("token did not authenticate an identity")
+
+// ValidateIdentity validates a raw token outside of an http request, such as a token carried by a queued message,
+// and returns the same Identity the middleware stores for http requests.
+//
+// The token is validated by the middleware over an equivalent POST request to / carrying the token as a bearer
+// token, so all configured checks apply, path and method specific options use their defaults. ctx is the context
+// of the request, its values are available to claim validators and its cancellation ends JWKS refreshes.
+//
+// Rejections are returned as the middleware returns them, ErrorReason classifies the error.
+func (a *Auth) ValidateIdentity(ctx context.Context, raw string) (Identity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(echo.HeaderAuthorization, bearerScheme+" "+raw)
+
+	var identity Identity
+
+	c := echo.New().NewContext(req, &discardResponseWriter{header: make(http.Header)})
+
+	err = a.Middleware()(func(c echo.Context) error {
+		identity, _ = IdentityFromContext(c.Request().Context())
+
+		return nil
+	})(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity == nil {
+		return nil, ErrNoIdentity
+	}
+
+	return identity, nil
+}
+
+// VerifySignature is a lower level alternative to ValidateIdentity for callers which authorize tokens themselves.
+// It only verifies:
+//
+//   - the token is decrypted if WithJWEDecrypter is set and doesn't use the none algorithm,
+//   - the signature, using the configured keys and any key id restrictions,
+//   - the exp and nbf claims when present, with the configured clock and clock skew,
+//   - the iss claim is present and matches the configured issuer, a fallback issuer or an alias.
+//
+// No other checks are performed, including the audience, scopes, roles, subject, issued at and lifetime options,
+// claim validators and token revocation. A ParseTokenFunc or NewClaimsFunc in the JWTConfig is not used and the
+// token cache is bypassed. The verified claims are returned for the caller to inspect.
+//
+// ctx is checked before the token is verified, JWKS refreshes are bound to the context provided to NewAuth.
+func (a *Auth) VerifySignature(ctx context.Context, raw string) (jwt.MapClaims, error) {
+	if a == nil || a.JWTConfig.KeyFunc == nil {
+		return nil, ErrAuthNotConfigured
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	raw, err := a.prepareToken(a.logger, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := a.verifyToken(raw, jwt.MapClaims{}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errInvalidToken
+	}
+
+	if a.issuer != "" {
+		if issuer, err := claims.GetIssuer(); err != nil || !a.validIssuer(issuer) {
+			return nil, errInvalidIssuer
+		}
+	}
+
+	return claims, nil
+}
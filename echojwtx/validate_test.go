@@ -0,0 +1,173 @@
+package echojwtx_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.infratographer.com/x/echojwtx"
+)
+
+func TestValidateIdentity(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer:   issuer,
+		Audience: "test-aud",
+	}, echojwtx.WithRequiredScopes("jobs:process"))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	type message struct {
+		id    string
+		token string
+	}
+
+	messages := make(chan message, 3)
+
+	messages <- message{"valid", testHelperMustSignClaims(map[string]interface{}{
+		"iss":   issuer,
+		"aud":   "test-aud",
+		"sub":   "urn:test:worker",
+		"scope": "jobs:process jobs:read",
+		"roles": []string{"operator"},
+	})}
+
+	messages <- message{"wrong-audience", testHelperMustSignClaims(map[string]interface{}{
+		"iss":   issuer,
+		"aud":   "other-aud",
+		"sub":   "urn:test:worker",
+		"scope": "jobs:process",
+	})}
+
+	messages <- message{"missing-scope", testHelperMustSignClaims(map[string]interface{}{
+		"iss":   issuer,
+		"aud":   "test-aud",
+		"sub":   "urn:test:worker",
+		"scope": "jobs:read",
+	})}
+
+	close(messages)
+
+	identities := make(map[string]echojwtx.Identity)
+	failures := make(map[string]error)
+
+	for msg := range messages {
+		identity, err := auth.ValidateIdentity(context.Background(), msg.token)
+		if err != nil {
+			failures[msg.id] = err
+
+			continue
+		}
+
+		identities[msg.id] = identity
+	}
+
+	require.Contains(t, identities, "valid", "expected valid message to be authenticated")
+
+	identity := identities["valid"]
+
+	assert.Equal(t, "urn:test:worker", identity.Subject(), "unexpected subject")
+	assert.True(t, identity.HasScope("jobs:read"), "expected jobs:read scope")
+	assert.True(t, identity.HasRole("operator"), "expected operator role")
+
+	aud, ok := identity.Claim("aud")
+	assert.True(t, ok, "expected aud claim")
+	assert.Equal(t, "test-aud", aud, "unexpected aud claim")
+
+	require.Len(t, failures, 2, "expected two messages to be rejected")
+
+	assert.Equal(t, echojwtx.ReasonInvalidAudience, echojwtx.ErrorReason(failures["wrong-audience"]), "unexpected reason")
+	assert.Equal(t, echojwtx.ReasonInsufficientScope, echojwtx.ErrorReason(failures["missing-scope"]), "unexpected reason")
+
+	var httpErr *echo.HTTPError
+
+	require.True(t, errors.As(failures["missing-scope"], &httpErr), "expected echo.HTTPError")
+	assert.Equal(t, http.StatusForbidden, httpErr.Code, "unexpected status")
+
+	_, err = auth.ValidateIdentity(context.Background(), "not-a-jwt")
+	assert.Equal(t, echojwtx.ReasonMalformedToken, echojwtx.ErrorReason(err), "unexpected reason for malformed token")
+}
+
+func TestVerifySignature(t *testing.T) {
+	issuer, closer := testHelperOIDCProvider(TestPrivRSAKey1ID)
+	defer closer()
+
+	auth, err := echojwtx.NewAuth(context.Background(), echojwtx.AuthConfig{
+		Issuer:   issuer,
+		Audience: "test-aud",
+	}, echojwtx.WithRequiredScopes("admin"))
+
+	require.NoError(t, err, "no error expected for NewAuth")
+
+	// audience and scopes are left to the caller.
+	claims, err := auth.VerifySignature(context.Background(), testHelperMustSignClaims(map[string]interface{}{
+		"iss": issuer,
+		"aud": "other-aud",
+		"sub": "urn:test:user",
+	}))
+
+	require.NoError(t, err, "no error expected verifying token")
+	assert.Equal(t, "other-aud", claims["aud"], "unexpected aud claim")
+	assert.Equal(t, "urn:test:user", claims["sub"], "unexpected sub claim")
+
+	testCases := []struct {
+		name         string
+		token        string
+		expectReason string
+	}{
+		{
+			"expired",
+			testHelperMustSignClaims(map[string]interface{}{
+				"iss": issuer,
+				"exp": time.Now().Add(-time.Minute).Unix(),
+			}),
+			echojwtx.ReasonTokenExpired,
+		},
+		{
+			"not valid yet",
+			testHelperMustSignClaims(map[string]interface{}{
+				"iss": issuer,
+				"nbf": time.Now().Add(time.Minute).Unix(),
+			}),
+			echojwtx.ReasonTokenNotValidYet,
+		},
+		{
+			"wrong issuer",
+			testHelperMustSignClaims(map[string]interface{}{
+				"iss": "https://other.example.com",
+			}),
+			echojwtx.ReasonInvalidIssuer,
+		},
+		{
+			"missing issuer",
+			testHelperMustSignClaims(map[string]interface{}{
+				"sub": "urn:test:user",
+			}),
+			echojwtx.ReasonInvalidIssuer,
+		},
+		{
+			"tampered signature",
+			testHelperMustSignClaims(map[string]interface{}{
+				"iss": issuer,
+			}) + "x",
+			echojwtx.ReasonInvalidSignature,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := auth.VerifySignature(context.Background(), tc.token)
+
+			require.Error(t, err, "expected token to be rejected")
+			assert.Equal(t, tc.expectReason, echojwtx.ErrorReason(err), "unexpected reason")
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnsupportedKey is returned when an offline key is created from a key which is not an RSA or EC private key.
+var ErrUnsupportedKey = errors.New("unsupported offline key, must be an rsa or ecdsa private key")
+
+// OfflineKey signs and validates tokens fully in memory, without an oidc provider or any http server.
+type OfflineKey struct {
+	kid    string
+	key    crypto.Signer
+	method jwt.SigningMethod
+	jwks   *keyfunc.JWKS
+}
+
+// NewOfflineKey creates an OfflineKey for the provided RSA or EC private key and key id.
+// RSA keys sign with RS256 and EC keys with ES256, ES384 or ES512 depending on the curve.
+func NewOfflineKey(kid string, key crypto.Signer) (*OfflineKey, error) {
+	var (
+		method jwt.SigningMethod
+		given  keyfunc.GivenKey
+	)
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+		given = keyfunc.NewGivenRSA(&k.PublicKey, keyfunc.GivenKeyOptions{Algorithm: method.Alg()})
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			return nil, ErrUnsupportedKey
+		}
+
+		given = keyfunc.NewGivenECDSA(&k.PublicKey, keyfunc.GivenKeyOptions{Algorithm: method.Alg()})
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	return &OfflineKey{
+		kid:    kid,
+		key:    key,
+		method: method,
+		jwks:   keyfunc.NewGiven(map[string]keyfunc.GivenKey{kid: given}),
+	}, nil
+}
+
+// Keyfunc implements jwt.Keyfunc, resolving the public key for tokens signed by the offline key.
+func (k *OfflineKey) Keyfunc(token *jwt.Token) (interface{}, error) {
+	return k.jwks.Keyfunc(token)
+}
+
+// Sign returns a token with the provided claims signed by the offline key.
+func (k *OfflineKey) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+
+	token.Header["kid"] = k.kid
+
+	return token.SignedString(k.key)
+}